@@ -0,0 +1,161 @@
+package overalls
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedDirs returns the directories of p, relative to it as the walker
+// sees them, holding files changed since the git ref, or nil when git can't
+// tell, in which case every directory is tested. With
+// Options.ChangedDependents the directories of the packages importing a
+// changed one, or whose tests do, are included too.
+func (r *runner) changedDirs(p project) map[string]bool {
+	root := gitRoot(p.path)
+	if len(root) == 0 {
+		r.logger.Printf("WARNING: '%s' is not in a git repository, testing every package\n", p.path)
+		return nil
+	}
+
+	cmd := exec.Command("git", "diff", "--name-only", "--no-renames", r.opts.ChangedSince, "--")
+	cmd.Dir = root
+
+	b, err := cmd.Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok && len(exit.Stderr) > 0 {
+			err = fmt.Errorf("%s", bytes.TrimSpace(exit.Stderr))
+		}
+		r.logger.Printf("WARNING: unable to list files changed since '%s', testing every package\n%s\n", r.opts.ChangedSince, err)
+		return nil
+	}
+
+	dir, err := filepath.EvalSymlinks(p.path)
+	if err != nil {
+		r.logger.Printf("WARNING: unable to list files changed since '%s', testing every package\n%s\n", r.opts.ChangedSince, err)
+		return nil
+	}
+
+	changed := map[string]bool{}
+
+	for _, name := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if len(name) == 0 {
+			continue
+		}
+
+		if rel, ok := changedPackageDir(root, dir, name); ok {
+			changed[rel] = true
+		}
+	}
+
+	if r.opts.Debug {
+		r.logger.Printf("Changed since %s: %d directories\n", r.opts.ChangedSince, len(changed))
+	}
+
+	if r.opts.ChangedDependents && len(changed) > 0 {
+		if err := r.addDependents(p, dir, changed); err != nil {
+			r.logger.Printf("WARNING: unable to list the packages depending on those changed, testing only the changed\n%s\n", err)
+		}
+	}
+
+	return changed
+}
+
+// changedPackageDir returns the directory of the package the file name,
+// relative to the git root, belongs to, relative to the project directory
+// dir. A file below a testdata directory belongs to the package holding it.
+// It reports false for files outside dir.
+func changedPackageDir(root, dir, name string) (string, bool) {
+	elems := strings.Split(name, "/")
+	elems = elems[:len(elems)-1]
+
+	for i, e := range elems {
+		if e == "testdata" {
+			elems = elems[:i]
+			break
+		}
+	}
+
+	rel, err := filepath.Rel(dir, filepath.Join(root, filepath.Join(elems...)))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+separator) {
+		return "", false
+	}
+
+	if rel == "." {
+		rel = ""
+	}
+
+	return rel, true
+}
+
+// addDependents adds to changed the directories of the packages of p,
+// whose directory with symlinks resolved is dir, that depend on one in
+// changed, directly or not, or whose tests import one.
+func (r *runner) addDependents(p project, dir string, changed map[string]bool) error {
+	args := []string{"list", "-e", "-f", "{{.Dir}}\t{{.ImportPath}}\t{{join .Deps \" \"}} {{join .TestImports \" \"}} {{join .XTestImports \" \"}}"}
+	if len(r.opts.Mod) > 0 && len(p.moduleRoot) > 0 {
+		args = append(args, "-mod="+r.opts.Mod)
+	}
+	if len(r.opts.Tags) > 0 {
+		args = append(args, "-tags="+r.opts.Tags)
+	}
+	args = append(args, "./...")
+
+	cmd := exec.Command(r.opts.GoCmd, args...)
+	cmd.Dir = p.path
+
+	b, err := cmd.Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok && len(exit.Stderr) > 0 {
+			err = fmt.Errorf("%s", bytes.TrimSpace(exit.Stderr))
+		}
+		return err
+	}
+
+	type pkg struct {
+		rel  string
+		deps []string
+	}
+
+	var pkgs []pkg
+	changedPaths := map[string]bool{}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		real, err := filepath.EvalSymlinks(fields[0])
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(dir, real)
+		if err != nil {
+			continue
+		}
+		if rel == "." {
+			rel = ""
+		}
+
+		if changed[rel] {
+			changedPaths[fields[1]] = true
+		}
+
+		pkgs = append(pkgs, pkg{rel: rel, deps: strings.Fields(fields[2])})
+	}
+
+	for _, pk := range pkgs {
+		for _, dep := range pk.deps {
+			if changedPaths[dep] {
+				changed[pk.rel] = true
+				break
+			}
+		}
+	}
+
+	return nil
+}
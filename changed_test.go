@@ -0,0 +1,130 @@
+package overalls
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+// changedRepo creates a GOPATH holding the git repository example.com/changed
+// with the packages a, b importing a, c and d/testdata, sets GOPATH to it and
+// returns the repository's directory and a func undoing it all.
+func changedRepo(t *testing.T) (string, func()) {
+	gopath, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+
+	oldPath, oldModule := os.Getenv("GOPATH"), os.Getenv("GO111MODULE")
+	os.Setenv("GOPATH", gopath)
+	os.Setenv("GO111MODULE", "off")
+
+	undo := func() {
+		os.Setenv("GOPATH", oldPath)
+		os.Setenv("GO111MODULE", oldModule)
+		os.RemoveAll(gopath)
+	}
+
+	dir := filepath.Join(gopath, "src", "example.com", "changed")
+
+	files := map[string]string{
+		"a/a.go":            "package a\n\nfunc A() int { return 1 }\n",
+		"a/a_test.go":       "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) { A() }\n",
+		"b/b.go":            "package b\n\nimport \"example.com/changed/a\"\n\nfunc B() int { return a.A() }\n",
+		"b/b_test.go":       "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) { B() }\n",
+		"c/c.go":            "package c\n\nfunc C() int { return 3 }\n",
+		"c/c_test.go":       "package c\n\nimport \"testing\"\n\nfunc TestC(t *testing.T) { C() }\n",
+		"d/d.go":            "package d\n",
+		"d/d_test.go":       "package d\n\nimport \"testing\"\n\nfunc TestD(t *testing.T) {}\n",
+		"d/testdata/in.txt": "in\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		Equal(t, os.MkdirAll(filepath.Dir(path), 0755), nil)
+		Equal(t, ioutil.WriteFile(path, []byte(content), 0644), nil)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=overalls", "-c", "user.email=overalls@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if b, err := cmd.CombinedOutput(); err != nil {
+			undo()
+			t.Fatalf("git %v: %s\n%s", args, err, b)
+		}
+	}
+
+	return dir, undo
+}
+
+func TestOveralls_ChangedSince(t *testing.T) {
+	dir, undo := changedRepo(t)
+	defer undo()
+
+	opts := Options{Project: "example.com/changed", ChangedSince: "HEAD"}
+
+	// nothing changed yet
+	packages, err := List(context.Background(), opts)
+	Equal(t, err, nil)
+	Equal(t, len(packages), 0)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "a", "a.go"), []byte("package a\n\nfunc A() int { return 2 }\n"), 0644)
+	Equal(t, err, nil)
+	err = ioutil.WriteFile(filepath.Join(dir, "d", "testdata", "in.txt"), []byte("changed\n"), 0644)
+	Equal(t, err, nil)
+
+	packages, err = List(context.Background(), opts)
+	Equal(t, err, nil)
+	Equal(t, packages, []string{"example.com/changed/a", "example.com/changed/d"})
+
+	opts.ChangedDependents = true
+
+	packages, err = List(context.Background(), opts)
+	Equal(t, err, nil)
+	Equal(t, packages, []string{"example.com/changed/a", "example.com/changed/b", "example.com/changed/d"})
+
+	res, err := Run(opts)
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 3)
+
+	// git can't tell, so everything is tested
+	out := &bytes.Buffer{}
+
+	packages, err = List(context.Background(), Options{Project: "example.com/changed", ChangedSince: "no-such-ref", Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	Equal(t, len(packages), 4)
+	MatchRegex(t, out.String(), "WARNING: unable to list files changed since 'no-such-ref', testing every package\n")
+
+	_, err = List(context.Background(), Options{Project: "example.com/changed", ChangedSince: "--output=x"})
+	Equal(t, err.Error(), "invalid changed-since '--output=x', must be a git ref")
+}
+
+func TestChangedPackageDir(t *testing.T) {
+	root := filepath.FromSlash("/repo")
+
+	tests := []struct {
+		dir, name, rel string
+		ok             bool
+	}{
+		{dir: "/repo", name: "a/a.go", rel: "a", ok: true},
+		{dir: "/repo", name: "go.mod", rel: "", ok: true},
+		{dir: "/repo", name: "a/testdata/x/in.txt", rel: "a", ok: true},
+		{dir: "/repo/sub", name: "sub/b/b.go", rel: "b", ok: true},
+		{dir: "/repo/sub", name: "a/a.go"},
+	}
+
+	for _, tt := range tests {
+		rel, ok := changedPackageDir(root, filepath.FromSlash(tt.dir), tt.name)
+		Equal(t, ok, tt.ok)
+		Equal(t, rel, filepath.FromSlash(tt.rel))
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/overalls"
+)
+
+// configFilename is the config file looked for when -config is not given.
+const configFilename = ".overalls.json"
+
+// findConfig returns the config file in the project directory, or failing
+// that the current directory, or an empty string when there is none.
+func findConfig(project string) string {
+	var dirs []string
+
+	if len(project) > 0 {
+		dirs = append(dirs, project, filepath.Join(overalls.GoPath(), "src", project))
+	}
+
+	dirs = append(dirs, ".")
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, configFilename)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// loadConfig reads the JSON object in the file at path, whose keys are flag
+// names, and sets each flag in fs that was not given on the command line to
+// its value. Lists are joined with commas, so
+//
+//	{"covermode": "atomic", "ignore": [".git", "vendor"], "concurrency": 4}
+//
+// is the same as -covermode=atomic -ignore=.git,vendor -concurrency=4, except
+// for repeatable flags which are set once per item.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var settings map[string]interface{}
+	if err = json.Unmarshal(b, &settings); err != nil {
+		return fmt.Errorf("invalid config '%s'\n%s", path, err)
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for name, v := range settings {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("invalid config '%s', unknown setting '%s'", path, name)
+		}
+
+		if given[name] {
+			continue
+		}
+
+		values := []interface{}{v}
+		if items, ok := v.([]interface{}); ok {
+			if _, repeatable := fs.Lookup(name).Value.(*listFlag); repeatable {
+				values = items
+			}
+		}
+
+		for _, v := range values {
+			value, err := configValue(v)
+			if err != nil {
+				return fmt.Errorf("invalid config '%s', setting '%s' %s", path, name, err)
+			}
+
+			if err = fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid config '%s', setting '%s' %s", path, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// configValue returns v, decoded from JSON, as a flag value.
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("must be a list of strings")
+			}
+			values[i] = s
+		}
+		return strings.Join(values, ","), nil
+	}
+
+	return "", fmt.Errorf("has unsupported value '%v'", v)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, configFilename)
+	err = ioutil.WriteFile(path, []byte(`{
+		"project": "github.com/bluesuncorp/overalls",
+		"covermode": "atomic",
+		"ignore": [".git", "vendor", "testdata"],
+		"concurrency": 4,
+		"timeout": "2m",
+		"race": true,
+		"env": ["A=1,2", "B=x=y"]
+	}`), 0644)
+	Equal(t, err, nil)
+
+	var project, covermode, ignore string
+	var concurrency int
+	var timeout time.Duration
+	var race bool
+	var env listFlag
+
+	fs := flag.NewFlagSet("overalls", flag.ContinueOnError)
+	fs.StringVar(&project, "project", "", "")
+	fs.StringVar(&covermode, "covermode", "", "")
+	fs.StringVar(&ignore, "ignore", "", "")
+	fs.IntVar(&concurrency, "concurrency", 1, "")
+	fs.DurationVar(&timeout, "timeout", 0, "")
+	fs.BoolVar(&race, "race", false, "")
+	fs.Var(&env, "env", "")
+
+	Equal(t, fs.Parse([]string{"-covermode=set"}), nil)
+	Equal(t, loadConfig(fs, path), nil)
+
+	Equal(t, project, "github.com/bluesuncorp/overalls")
+	Equal(t, covermode, "set")
+	Equal(t, ignore, ".git,vendor,testdata")
+	Equal(t, concurrency, 4)
+	Equal(t, timeout, 2*time.Minute)
+	Equal(t, race, true)
+	Equal(t, []string(env), []string{"A=1,2", "B=x=y"})
+	Equal(t, findConfig(dir), path)
+}
+
+func TestLoadConfig_Unknown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, configFilename)
+	Equal(t, ioutil.WriteFile(path, []byte(`{"bogus": true}`), 0644), nil)
+
+	fs := flag.NewFlagSet("overalls", flag.ContinueOnError)
+	NotEqual(t, loadConfig(fs, path), nil)
+}
@@ -0,0 +1,542 @@
+/*
+Command overalls takes multi-package go projects, runs test coverage tests on
+all packages in each directory and finally concatenates into a single file for
+tools like goveralls.
+
+	$ overalls -help
+
+	usage: overalls -project=[path] -covermode[mode] OPTIONS
+
+	overalls recursively traverses your projects directory structure
+	running 'go test -covermode=count -coverprofile=profile.coverprofile'
+	in each directory with go test files, concatenates them into one
+	coverprofile in your root directory named 'overalls.coverprofile'
+
+	OPTIONS
+	  -project
+		Your project path relative to the '$GOPATH/src' directory
+		example: -project=github.com/bluesuncorp/overalls
+		An absolute path, or one starting with ./ or ../, is used as the
+		project directory directly.
+		example: -project=../overalls
+		When a go.mod is found in the project or current directory, or
+		in one of their parents, the path is treated as a filesystem path,
+		or an import path within that module, instead.
+		Directories below it with their own go.mod are tested as part of
+		that nested module, from its directory.
+		example: -project=./
+		Several comma separated projects are tested in the same run,
+		merged into the output of the first.
+		example: -project=github.com/org/a,github.com/org/b
+		Without -project it is inferred from the current directory: the
+		directory itself when it or a parent holds a go.mod, or its
+		import path when it is within '$GOPATH/src'.
+		example: cd $GOPATH/src/github.com/org/a && overalls
+		A project directory that is a symlink is followed, but as with
+		go test ./... no symlink below it is, a warning naming each.
+
+	  -covermode
+	    Mode to run when testing files, one of set, count or atomic.
+	    default:count, or atomic with -race
+
+	OPTIONAL
+
+	  -root
+	    The directory to walk and run go test from, -project then being only the
+	    import path of that directory rather than also where it is, for module
+	    or vendored layouts where one can't be derived from the other. In module
+	    mode a go.mod in it is used. Requires a single -project.
+	    example: -root=/src/checkout -project=example.com/org/repo
+	    default: derived from -project
+
+	  -ignore
+	    A comma separated list of directory names to ignore, relative to project path.
+	    example: -ignore=[.git,.hiddentdir...]
+	    Entries may also be 'dir/...' for a directory and all below it, globs,
+	    matched against the relative path or its last element at any depth, or
+	    regular expressions prefixed with 're:'. As with go test ./..., testdata
+	    and directories starting with '.' or '_' are skipped whatever the list.
+	    example: -ignore=.git,*_generated,re:(^|/)fixtures$
+	    default: '.git'
+
+	  -skip-vendor
+	    Skip vendor directories at any depth, as go test ./... does, whatever
+	    -ignore. Disable it to cover vendored packages of your own.
+	    example: -skip-vendor=false
+	    default: true
+
+	  -skip-incompatible
+	    Skip the packages whose files are all excluded by the build constraints,
+	    such as those of another OS or architecture, rather than failing the run
+	    with "build constraints exclude all Go files". Each package is checked
+	    with go list, using the -env and -tags go test is run with.
+	    example: -skip-incompatible -env=GOARCH=386
+	    default:false
+
+	  -max-depth
+	    Skip the directories more than this many levels below the project,
+	    without walking them, for deep trees whose tests are all near the top.
+	    Applies along with -ignore and -include. 0 means no limit.
+	    example: -max-depth=3
+	    default:0
+
+	  -debug
+	    A flag indicating whether to print debug messages.
+	    example: -debug
+	    default:false
+
+	  -concurrency
+	    The maximum number of packages to test at the same time, each in its
+	    own go test process. See -parallel for the tests within a package.
+	    example: -concurrency=1
+	    default: number of CPUs
+
+	  -timeout
+	    Passed to each go test invocation as -timeout. A package still running
+	    a minute after this is killed and marked as failed. With -go-test-timeout
+	    it is only when a package is killed, as a last resort.
+	    example: -timeout=120s
+	    default: go test's default
+
+	  -go-test-timeout
+	    Passed to each go test invocation as its -timeout, in place of -timeout.
+	    A test running longer fails with the stack of every goroutine, showing
+	    where it hung, whereas a package that is killed shows nothing. Set
+	    -timeout longer to only kill the packages still running past it, by
+	    default a minute later.
+	    example: -go-test-timeout=5m -timeout=10m
+	    default: -timeout
+
+	  -output
+	    The file to write the merged coverprofile to, relative paths are
+	    resolved against the directory overalls was run from. '-' writes it to
+	    stdout, with all other output moved to stderr. Missing directories are
+	    created, as they are for -cobertura, -lcov and -html. While testing,
+	    the coverage collected so far is written to a temporary file beside it,
+	    named after it and ending in '.partial', renamed into place once done,
+	    so runs sharing the file don't write over each other's and a killed run
+	    leaves its coverage there.
+	    example: -output=coverage/all.coverprofile
+	    example: -output=- | some-uploader
+	    default: 'overalls.coverprofile' in the project directory
+
+	  -coverpkg
+	    Passed to each go test invocation as -coverpkg, so coverage is measured
+	    across the listed packages and not only the package under test.
+	    example: -coverpkg=./...
+
+	  -fail-under
+	    Exit with an error when the total statement coverage of the merged
+	    profile is below this percentage, which is always printed when set.
+	    example: -fail-under=80.0
+	    default: 0, never fail
+
+	  -package-min
+	    The minimum coverage of the packages matching a pattern, as pattern=percent,
+	    the pattern taking the same form as -ignore matched against the import
+	    path. Every package below its minimum is listed and the run fails. The
+	    first matching entry applies, packages matching none must reach
+	    -fail-under. May be repeated, or given as a list in the config file.
+	    example: -package-min=github.com/x/y/billing/...=90
+	    default: none
+
+	  -no-summary
+	    Do not print the table of each package's statement coverage and the
+	    total after the run.
+	    example: -no-summary
+	    default:false
+
+	  -summary-sort
+	    The order of the coverage summary table: path, by import path, coverage,
+	    the least covered packages first, or name, by the last element of the
+	    import path.
+	    example: -summary-sort=coverage
+	    default: path
+
+	  -race
+	    Run go test with the race detector. This requires covermode atomic,
+	    any other covermode is replaced with atomic and a warning is printed,
+	    or with -strict-covermode is an error.
+	    example: -race
+	    default:false
+
+	  -strict-covermode
+	    Make a covermode other than atomic along with -race an error rather
+	    than replacing it with atomic.
+	    example: -strict-covermode -race -covermode=atomic
+	    default:false
+
+	  -config
+	    A JSON file of settings keyed by flag name, used for any flag not given
+	    on the command line. Lists such as ignore are joined with commas.
+	    example: -config=ci/overalls.json
+	    example: {"project": "github.com/bluesuncorp/overalls", "covermode": "atomic",
+	              "ignore": [".git", "vendor"], "concurrency": 4, "timeout": "2m"}
+	    default: '.overalls.json' in the project or current directory, if any
+
+	  -include
+	    A comma separated list of directories to test, relative to project path,
+	    in the same forms as -ignore. When empty every directory is tested.
+	    -ignore takes precedence.
+	    example: -include=./internal/...,cmd/*
+	    default: ''
+
+	  -dry-run
+	    Print each package that would be tested, and each directory skipped with
+	    the reason, without running go test or writing a coverprofile.
+	    example: -dry-run
+	    default:false
+
+	  -tags
+	    A comma separated list of build tags passed to each go test invocation.
+	    Directories whose test files are all excluded by build constraints are
+	    skipped.
+	    example: -tags=integration,e2e
+	    default: ''
+
+	  -tags-map
+	    The build tags, as pattern=tags, of the packages matching pattern
+	    instead of -tags, for repositories whose packages need different ones.
+	    Patterns take the same form as -include, matched against the package
+	    directory relative to the project. The first matching entry is used.
+	    May be repeated, or given as a list in the config file.
+	    example: -tags-map='cmd/...=integration' -tags-map='internal/db=db,e2e'
+	    default: ''
+
+	  -retries
+	    How many more times to run go test for a package whose tests fail before
+	    marking it as failed, each attempt with its own -timeout. The coverage of
+	    the passing attempt is used and every retry is logged.
+	    example: -retries=2
+	    default:0
+
+	  -retry-backoff
+	    How long to wait before each retry, for tests failing again right away
+	    on ports or databases still held by the last attempt. The wait ends
+	    early when the run is canceled or times out, without retrying.
+	    example: -retry-backoff=2s
+	    default: no wait
+
+	  -retry-exponential
+	    Double -retry-backoff after each retry of a package, so with
+	    -retry-backoff=2s the retries wait 2s, 4s, 8s and so on.
+	    example: -retry-exponential
+	    default:false
+
+	  -json
+	    Print a JSON object describing the run to stdout once the merged
+	    coverprofile is written, with each package's path, coverage, pass or fail
+	    status, attempts and duration in seconds. All other output goes to stderr.
+	    Can not be used with -output=-.
+	    example: -json
+	    default:false
+
+	  -merge
+	    An existing coverprofile, such as one from another CI job, whose blocks
+	    are merged into the output. Counts of blocks found in both are summed. Its
+	    covermode must match -covermode.
+	    example: -merge=unit.coverprofile
+	    default: ''
+
+	  -quiet
+	    Do not print which package is being tested or the go test output of
+	    passing packages, only failures and the summary.
+	    example: -quiet
+	    default:false
+
+	  -quiet-go
+	    Only print the go test output of failing packages, as -quiet does, but
+	    still print which package is being tested. The output of each package is
+	    printed at once when it fails, not mixed with that of the others.
+	    example: -quiet-go
+	    default:false
+
+	  -progress
+	    When printing to a terminal, keep a "tested X/Y packages" line at the
+	    bottom, updated as each package finishes, and print only the go test
+	    output of failing packages as with -quiet, unless -debug is given.
+	    Otherwise, or with -log-format=json, it has no effect.
+	    example: -progress
+	    default:false
+
+	  -keep-profiles
+	    Leave the -profile-name file go test writes in each package directory,
+	    which is otherwise removed once merged.
+	    example: -keep-profiles
+	    default:false
+
+	  -global-timeout
+	    Stop the whole run after this long, killing the packages still being
+	    tested and writing the coverage collected so far, then exit with status 3.
+	    Unlike -timeout this bounds the total time regardless of package count.
+	    example: -global-timeout=30m
+	    default: no limit
+
+	  -watch
+	    Keep running, testing the project again each time one of its .go files
+	    is added, changed or removed, until interrupted. Only the packages with
+	    changed files, and those importing them, are tested again, the others
+	    keeping their last coverage so the coverprofile is always complete, or
+	    every package with -coverpkg. -progress is not shown while watching.
+	    example: -watch
+	    default:false
+
+	  -gocmd
+	    The go command used to run the tests, such as a specific toolchain or a
+	    wrapper script, instead of the go on the PATH. It must be found before
+	    anything is tested, -debug printing the version it reports.
+	    example: -gocmd=/usr/local/go1.21/bin/go
+	    default: go
+
+	  -mod
+	    The -mod passed to go test for modules, one of readonly, vendor or mod,
+	    overriding any -mod in GOFLAGS. GOFLAGS is otherwise honored, as by
+	    every go command. It is not passed for projects resolved via GOPATH.
+	    -debug prints the module mode in effect.
+	    example: -mod=vendor
+	    default: ''
+
+	  -short
+	    Run go test with -short, skipping the long tests that check
+	    testing.Short(). Combines with -race and -tags.
+	    example: -short
+	    default:false
+
+	  -use-gitignore
+	    Also skip the directories ignored by the .gitignore files in the project,
+	    on top of -ignore.
+	    example: -use-gitignore
+	    default:false
+
+	  -fail-fast
+	    Stop once a package fails, killing the packages still being tested and
+	    writing the coverage collected so far. By default every package is tested
+	    and all failures are reported.
+	    example: -fail-fast
+	    default:false
+
+	  -max-failures
+	    Stop as -fail-fast does once this many packages have failed, past which
+	    the run is clearly broken, rather than at the first. 0 means no limit.
+	    example: -max-failures=5
+	    default:0
+
+	  -json-events
+	    Run go test with -json and count the tests of each package that passed,
+	    failed and were skipped, printed after its coverage in the summary. The
+	    output is still printed as text and coverage collected as usual.
+	    example: -json-events
+	    default:false
+
+	  -cpu
+	    Comma separated GOMAXPROCS values passed to go test as -cpu. Each
+	    package's tests run once per value, and per -count if given after --, all
+	    recorded in the single profile go test writes, so count mode sums them.
+	    example: -cpu=1,2,4
+	    default: ''
+
+	  -cobertura
+	    Also write the merged coverage as a Cobertura XML report, for CI systems
+	    that show coverage in that format.
+	    example: -cobertura=coverage.xml
+	    default: ''
+
+	  -lcov
+	    Also write the merged coverage as an lcov tracefile, with a line record
+	    for each line a statement starts on, read from the source files, for
+	    editors and tools showing coverage in that format.
+	    example: -lcov=coverage.info
+	    default: ''
+
+	  -count
+	    Passed to go test as -count. Go caches test results, replaying the cached
+	    coverprofile of unchanged packages; -count=1 bypasses the cache so every
+	    package is tested afresh, which is slower, especially on large projects.
+	    example: -count=1
+	    default: go test's default, cached results are used
+
+	  -allow-empty
+	    Exit successfully when no packages are tested. Otherwise a run that tests
+	    nothing, say because of a typo in -project or -include, exits with
+	    status 4.
+	    example: -allow-empty
+	    default:false
+
+	  -log-format
+	    The format of overalls' output, text or json. With json every message,
+	    including the go test output, and every package starting, passing or
+	    failing is logged as one JSON object per line, with its level.
+	    example: -log-format=json
+	    default: text
+
+	  -slowest
+	    After the run print this many of the packages that took longest to test,
+	    slowest first, with their durations including retries. Failed packages
+	    are listed too.
+	    example: -slowest=10
+	    default: 0, not printed
+
+	  -prefix-replace
+	    Replace the prefix of each file path in the merged coverprofile, given
+	    as old=new, so a profile generated in a container matches the source
+	    tree it is uploaded from. Paths not starting with old are left as is.
+	    example: -prefix-replace=/go/src/github.com/org/repo/=github.com/org/repo/
+	    default: ''
+
+	  -verbose-tests
+	    Run go test with -v, printing the output of every test line by line as
+	    it runs. This is independent of -debug, which only controls overalls'
+	    own messages.
+	    example: -verbose-tests
+	    default:false
+
+	  -profile-name
+	    The file name of the coverprofile go test writes in each package
+	    directory before it is merged, for when a package has a file of that
+	    name or other tooling writes one. Must not contain a path separator.
+	    example: -profile-name=.overalls-profile.out
+	    default: 'profile.coverprofile'
+
+	  -html
+	    Also write the merged coverage as an HTML report, as 'go tool cover -html'
+	    does, to browse the covered source. Failing to write it is reported but
+	    the coverprofile is still written.
+	    example: -html=coverage.html
+	    default: ''
+
+	  -env
+	    An environment variable, as KEY=VALUE, set for each go test invocation on
+	    top of overalls' own environment. May be repeated, the last of duplicate
+	    keys is used. In a config file it is a list.
+	    example: -env=DB_URL=postgres://localhost/test?sslmode=disable -env=STAGE=ci
+	    default: ''
+
+	  -fresh-cache
+	    Point GOCACHE at a new temporary directory for the run, removed once it is
+	    done, so nothing is replayed from a shared or stale build cache and your
+	    own is left untouched. Every package is then built from scratch. It
+	    takes precedence over a GOCACHE given with -env.
+	    example: -fresh-cache
+	    default:false
+
+	  -coveralls
+	    Post the merged coverage to Coveralls with this repo token once it is
+	    written, along with the commit and branch checked out in the project.
+	    File names are sent relative to the project's git repository. Nothing is
+	    posted unless this or the COVERALLS_TOKEN environment variable is set.
+	    example: -coveralls=$COVERALLS_REPO_TOKEN
+	    default: $COVERALLS_TOKEN
+
+	  -cpuprofile, -memprofile, -blockprofile
+	    File names passed to go test with the flag of the same name. Each is
+	    written in every tested package's directory, next to the test binary
+	    go test keeps to read it with, and left there. They multiply what a run
+	    writes by the number of packages and slow the tests down, so are meant
+	    for targeted runs, say of one package with -include.
+	    example: -cpuprofile=cpu.pprof -include=internal/parser
+	    default: ''
+
+	  -exclude-files
+	    A comma separated list of files, such as generated code, whose coverage
+	    is left out of the merged coverprofile, summary and reports. Patterns
+	    take the same forms as -ignore but match the file's import path, globs
+	    also matching its name. The packages tested are unaffected.
+	    example: -exclude-files=*.pb.go,mock_*.go
+	    default: ''
+
+	  -parallel
+	    Passed to go test as -parallel, the maximum number of tests calling
+	    t.Parallel that run at the same time within one package. It does not
+	    change how many packages are tested at once, that is -concurrency, so up
+	    to -concurrency times -parallel tests may run together.
+	    example: -parallel=4
+	    default: GOMAXPROCS, go test's own default
+
+	  -baseline
+	    A coverprofile to compare the coverage with, such as the -output of a
+	    run on the target branch. The change of each package and the total is
+	    printed after the summary, followed by each line a statement starts on
+	    left uncovered that the baseline covered or did not have, as file:line
+	    or file:first-last.
+	    Lines are matched by number, so code moved since shows up too.
+	    example: -baseline=main.coverprofile
+	    default: ''
+
+	  -fail-on-decrease
+	    Exit with an error when the total coverage is below that of -baseline.
+	    example: -baseline=main.coverprofile -fail-on-decrease
+	    default:false
+
+	  -list-packages
+	    Print the import path of each package that would be tested, one per line
+	    and nothing else, without running go test or writing a coverprofile.
+	    -ignore, -include and -tags apply as for a run. Unlike -dry-run it is
+	    meant for other programs to read.
+	    example: -list-packages | xargs go vet
+	    default:false
+
+	  -allow-build-failures
+	    Quarantine packages that fail to build, as happens mid-refactor: they
+	    are reported at the end, and in -json, but neither stop the run with
+	    -fail-fast nor make it exit with an error. Packages whose tests fail
+	    still do.
+	    example: -allow-build-failures
+	    default:false
+
+	  -testflags
+	    Flags passed to go test, before any given after --, split into
+	    arguments as a shell would: quote arguments with spaces and escape
+	    quotes with a backslash. Unlike -- it can be set in the config file.
+	    Flags taking a value may be given as -run=TestA or -run TestA, and
+	    any from -args on are passed to the test binary.
+	    example: -testflags="-run='TestA|TestB' -failfast"
+	    default: ''
+
+	  -output-mode
+	    The mode line written to the merged coverprofile, one of set, count or
+	    atomic, for tools that expect a particular one. The counts are written
+	    as go test recorded them, so a warning is printed when it differs from
+	    the -covermode.
+	    example: -output-mode=set
+	    default: the -covermode
+
+	  -changed-since
+	    Only test the packages holding a file changed since this git ref, as
+	    listed by git diff, so committed or not but not untracked. A file below
+	    testdata counts for the package holding it. When git can't tell, say
+	    for an unknown ref, every package is tested with a warning. When
+	    nothing changed nothing is tested, pass -allow-empty to succeed then.
+	    example: -changed-since=origin/main
+	    default: ''
+
+	  -changed-dependents
+	    With -changed-since, also test the packages of the project that import
+	    a changed package, directly or not, or whose tests do.
+	    example: -changed-since=origin/main -changed-dependents
+	    default:false
+
+	  -require-tests
+	    Fail the run when a package has Go files but no test files, listing
+	    them at the end, to enforce that every package has tests. Directories
+	    left out by -ignore, -include or -changed-since are not checked.
+	    example: -require-tests
+	    default:false
+
+	  -split-output
+	    Also write each package's coverprofile, as go test wrote it, to the
+	    directory at its import path with '.coverprofile' appended, for tooling
+	    analyzing coverage per package or module. Profiles of earlier runs are
+	    overwritten but not removed.
+	    example: -split-output=coverage
+	    default: ''
+
+	  -prebuild
+	    Run 'go build ./...' or 'go vet ./...' in each project directory before
+	    testing, with -tags, -mod and -env, stopping with go's output when it
+	    fails, so a compile error is reported once rather than by every package
+	    depending on it. vet also compiles the test files, and fails on its own
+	    findings. -ignore does not apply.
+	    example: -prebuild=vet
+	    default: ''
+*/
+package main
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/overalls"
+)
+
+// jsonLine is a single line of -log-format=json output.
+type jsonLine struct {
+	Time     string   `json:"time"`
+	Level    string   `json:"level"`
+	Event    string   `json:"event"`
+	Package  string   `json:"package,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Coverage *float64 `json:"coverage,omitempty"`
+	Duration *float64 `json:"duration,omitempty"`
+	Change   *float64 `json:"change,omitempty"`
+	Lines    string   `json:"lines,omitempty"`
+	Attempts int      `json:"attempts,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// jsonLog writes log messages and package events as one JSON object per
+// line. It is an io.Writer for a log.Logger, each write being one message.
+type jsonLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// newJSONLog returns a jsonLog writing to w.
+func newJSONLog(w io.Writer) *jsonLog {
+	return &jsonLog{enc: json.NewEncoder(w), now: time.Now}
+}
+
+// Write logs p as a message, at the warn or error level when it starts
+// with WARNING: or ERROR: as overalls' own messages do.
+func (l *jsonLog) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if len(msg) == 0 {
+		return len(p), nil
+	}
+
+	level := "info"
+	switch {
+	case strings.HasPrefix(msg, "WARNING:"):
+		level = "warn"
+	case strings.HasPrefix(msg, "ERROR:"), strings.HasPrefix(msg, "**"):
+		level = "error"
+	}
+
+	if err := l.write(jsonLine{Level: level, Event: "log", Message: msg}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// event logs e, it is used as Options.OnEvent.
+func (l *jsonLog) event(e overalls.Event) {
+	line := jsonLine{Level: "info", Event: string(e.Type), Package: e.ImportPath}
+
+	if e.Type != overalls.EventStart {
+		coverage, duration := e.Coverage, e.Duration.Seconds()
+		line.Coverage = &coverage
+		line.Duration = &duration
+		line.Attempts = e.Attempts
+	}
+
+	if e.Err != nil {
+		line.Level = "error"
+		line.Error = e.Err.Error()
+	}
+
+	l.write(line)
+}
+
+// summary logs the coverage of each package of res and the total.
+func (l *jsonLog) summary(res overalls.Result) {
+	for _, p := range res.Summary {
+		coverage := p.Coverage
+		l.write(jsonLine{Level: "info", Event: "summary", Package: p.Package, Coverage: &coverage})
+	}
+
+	coverage := res.Coverage
+	l.write(jsonLine{Level: "info", Event: "total", Coverage: &coverage})
+}
+
+// delta logs the change in coverage of each package of res and the total
+// since the baseline, and each range of newly uncovered lines.
+func (l *jsonLog) delta(res overalls.Result) {
+	for _, p := range res.Delta.Packages {
+		coverage, change := p.Coverage, p.Change
+		l.write(jsonLine{Level: "info", Event: "delta", Package: p.Package, Coverage: &coverage, Change: &change})
+	}
+
+	coverage, change := res.Coverage, res.Delta.Change
+	l.write(jsonLine{Level: "info", Event: "delta_total", Coverage: &coverage, Change: &change})
+
+	for _, r := range lineRanges(res.Delta.Uncovered) {
+		l.write(jsonLine{Level: "warn", Event: "uncovered", Lines: r})
+	}
+}
+
+// slowest logs how long each of packages took to test.
+func (l *jsonLog) slowest(packages []overalls.PackageResult) {
+	for _, p := range packages {
+		duration := p.Duration.Seconds()
+		line := jsonLine{Level: "info", Event: "slowest", Package: p.ImportPath, Duration: &duration}
+		if p.Err != nil {
+			line.Error = p.Err.Error()
+		}
+		l.write(line)
+	}
+}
+
+func (l *jsonLog) write(line jsonLine) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	line.Time = l.now().UTC().Format(time.RFC3339Nano)
+
+	return l.enc.Encode(line)
+}
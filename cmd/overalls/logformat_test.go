@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/overalls"
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestJSONLog(t *testing.T) {
+	buff := &bytes.Buffer{}
+	jl := newJSONLog(buff)
+	jl.now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	logger := log.New(jl, "", 0)
+	logger.Println("Test package: example.com/a")
+	logger.Printf("WARNING: something\n")
+	logger.Printf("\n**2 package(s) failed\n")
+
+	jl.event(overalls.Event{Type: overalls.EventStart, PackageResult: overalls.PackageResult{ImportPath: "example.com/a"}})
+	jl.event(overalls.Event{Type: overalls.EventDone, PackageResult: overalls.PackageResult{ImportPath: "example.com/a", Coverage: 50, Attempts: 1, Duration: 2 * time.Second}})
+	jl.event(overalls.Event{Type: overalls.EventFailed, PackageResult: overalls.PackageResult{ImportPath: "example.com/b", Attempts: 1, Err: errors.New("exit status 1")}})
+
+	jl.summary(overalls.Result{Coverage: 50, Summary: []overalls.PackageCoverage{{Package: "example.com/a", Coverage: 50}}})
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	Equal(t, len(lines), 8)
+
+	Equal(t, lines[0], `{"time":"2020-01-02T03:04:05Z","level":"info","event":"log","message":"Test package: example.com/a"}`)
+	Equal(t, lines[3], `{"time":"2020-01-02T03:04:05Z","level":"info","event":"start","package":"example.com/a"}`)
+	Equal(t, lines[4], `{"time":"2020-01-02T03:04:05Z","level":"info","event":"done","package":"example.com/a","coverage":50,"duration":2,"attempts":1}`)
+	Equal(t, lines[7], `{"time":"2020-01-02T03:04:05Z","level":"info","event":"total","coverage":50}`)
+
+	var line jsonLine
+	err := json.Unmarshal([]byte(lines[1]), &line)
+	Equal(t, err, nil)
+	Equal(t, line.Level, "warn")
+
+	err = json.Unmarshal([]byte(lines[2]), &line)
+	Equal(t, err, nil)
+	Equal(t, line.Level, "error")
+	Equal(t, line.Message, "**2 package(s) failed")
+
+	err = json.Unmarshal([]byte(lines[5]), &line)
+	Equal(t, err, nil)
+	Equal(t, line.Level, "error")
+	Equal(t, line.Event, "failed")
+	Equal(t, line.Error, "exit status 1")
+}
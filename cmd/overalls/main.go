@@ -0,0 +1,1385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-playground/overalls"
+)
+
+const (
+	helpString = `
+usage: overalls -project=[path] -covermode[mode] OPTIONS
+
+overalls recursively traverses your projects directory structure
+running 'go test -covermode=count -coverprofile=profile.coverprofile'
+in each directory with go test files, concatenates them into one
+coverprofile in your root directory named 'overalls.coverprofile'
+
+OPTIONS
+  -project
+	Your project path relative to the '$GOPATH/src' directory
+	example: -project=github.com/bluesuncorp/overalls
+	An absolute path, or one starting with ./ or ../, is used as the
+	project directory directly.
+	example: -project=../overalls
+	When a go.mod is found in the project or current directory, or
+	in one of their parents, the path is treated as a filesystem path,
+	or an import path within that module, instead.
+	Directories below it with their own go.mod are tested as part of
+	that nested module, from its directory.
+	example: -project=./
+	Several comma separated projects are tested in the same run,
+	merged into the output of the first.
+	example: -project=github.com/org/a,github.com/org/b
+	Without -project it is inferred from the current directory: the
+	directory itself when it or a parent holds a go.mod, or its
+	import path when it is within '$GOPATH/src'.
+	example: cd $GOPATH/src/github.com/org/a && overalls
+	A project directory that is a symlink is followed, but as with
+	go test ./... no symlink below it is, a warning naming each.
+
+  -covermode
+    Mode to run when testing files, one of set, count or atomic.
+    default:count, or atomic with -race
+
+OPTIONAL
+
+  -root
+    The directory to walk and run go test from, -project then being only the
+    import path of that directory rather than also where it is, for module
+    or vendored layouts where one can't be derived from the other. In module
+    mode a go.mod in it is used. Requires a single -project.
+    example: -root=/src/checkout -project=example.com/org/repo
+    default: derived from -project
+
+  -ignore
+    A comma separated list of directory names to ignore, relative to project path.
+    example: -ignore=[.git,.hiddentdir...]
+    Entries may also be 'dir/...' for a directory and all below it, globs,
+    matched against the relative path or its last element at any depth, or
+    regular expressions prefixed with 're:'. As with go test ./..., testdata
+    and directories starting with '.' or '_' are skipped whatever the list.
+    example: -ignore=.git,*_generated,re:(^|/)fixtures$
+    default: '.git'
+
+  -skip-vendor
+    Skip vendor directories at any depth, as go test ./... does, whatever
+    -ignore. Disable it to cover vendored packages of your own.
+    example: -skip-vendor=false
+    default: true
+
+  -skip-incompatible
+    Skip the packages whose files are all excluded by the build constraints,
+    such as those of another OS or architecture, rather than failing the run
+    with "build constraints exclude all Go files". Each package is checked
+    with go list, using the -env and -tags go test is run with.
+    example: -skip-incompatible -env=GOARCH=386
+    default:false
+
+  -max-depth
+    Skip the directories more than this many levels below the project,
+    without walking them, for deep trees whose tests are all near the top.
+    Applies along with -ignore and -include. 0 means no limit.
+    example: -max-depth=3
+    default:0
+
+  -debug
+    A flag indicating whether to print debug messages.
+    example: -debug
+    default:false
+
+  -concurrency
+    The maximum number of packages to test at the same time, each in its
+    own go test process. See -parallel for the tests within a package.
+    example: -concurrency=1
+    default: number of CPUs
+
+  -timeout
+    Passed to each go test invocation as -timeout. A package still running
+    a minute after this is killed and marked as failed. With -go-test-timeout
+    it is only when a package is killed, as a last resort.
+    example: -timeout=120s
+    default: go test's default
+
+  -go-test-timeout
+    Passed to each go test invocation as its -timeout, in place of -timeout.
+    A test running longer fails with the stack of every goroutine, showing
+    where it hung, whereas a package that is killed shows nothing. Set
+    -timeout longer to only kill the packages still running past it, by
+    default a minute later.
+    example: -go-test-timeout=5m -timeout=10m
+    default: -timeout
+
+  -output
+    The file to write the merged coverprofile to, relative paths are
+    resolved against the directory overalls was run from. '-' writes it to
+    stdout, with all other output moved to stderr. Missing directories are
+    created, as they are for -cobertura, -lcov and -html. While testing,
+    the coverage collected so far is written to a temporary file beside it,
+    named after it and ending in '.partial', renamed into place once done,
+    so runs sharing the file don't write over each other's and a killed run
+    leaves its coverage there.
+    example: -output=coverage/all.coverprofile
+    example: -output=- | some-uploader
+    default: 'overalls.coverprofile' in the project directory
+
+  -coverpkg
+    Passed to each go test invocation as -coverpkg, so coverage is measured
+    across the listed packages and not only the package under test.
+    example: -coverpkg=./...
+
+  -fail-under
+    Exit with an error when the total statement coverage of the merged
+    profile is below this percentage, which is always printed when set.
+    example: -fail-under=80.0
+    default: 0, never fail
+
+  -package-min
+    The minimum coverage of the packages matching a pattern, as pattern=percent,
+    the pattern taking the same form as -ignore matched against the import
+    path. Every package below its minimum is listed and the run fails. The
+    first matching entry applies, packages matching none must reach
+    -fail-under. May be repeated, or given as a list in the config file.
+    example: -package-min=github.com/x/y/billing/...=90
+    default: none
+
+  -no-summary
+    Do not print the table of each package's statement coverage and the
+    total after the run.
+    example: -no-summary
+    default:false
+
+  -summary-sort
+    The order of the coverage summary table: path, by import path, coverage,
+    the least covered packages first, or name, by the last element of the
+    import path.
+    example: -summary-sort=coverage
+    default: path
+
+  -race
+    Run go test with the race detector. This requires covermode atomic,
+    any other covermode is replaced with atomic and a warning is printed,
+    or with -strict-covermode is an error.
+    example: -race
+    default:false
+
+  -strict-covermode
+    Make a covermode other than atomic along with -race an error rather
+    than replacing it with atomic.
+    example: -strict-covermode -race -covermode=atomic
+    default:false
+
+  -config
+    A JSON file of settings keyed by flag name, used for any flag not given
+    on the command line. Lists such as ignore are joined with commas.
+    example: -config=ci/overalls.json
+    example: {"project": "github.com/bluesuncorp/overalls", "covermode": "atomic",
+              "ignore": [".git", "vendor"], "concurrency": 4, "timeout": "2m"}
+    default: '.overalls.json' in the project or current directory, if any
+
+  -include
+    A comma separated list of directories to test, relative to project path,
+    in the same forms as -ignore. When empty every directory is tested.
+    -ignore takes precedence.
+    example: -include=./internal/...,cmd/*
+    default: ''
+
+  -dry-run
+    Print each package that would be tested, and each directory skipped with
+    the reason, without running go test or writing a coverprofile.
+    example: -dry-run
+    default:false
+
+  -tags
+    A comma separated list of build tags passed to each go test invocation.
+    Directories whose test files are all excluded by build constraints are
+    skipped.
+    example: -tags=integration,e2e
+    default: ''
+
+  -tags-map
+    The build tags, as pattern=tags, of the packages matching pattern
+    instead of -tags, for repositories whose packages need different ones.
+    Patterns take the same form as -include, matched against the package
+    directory relative to the project. The first matching entry is used.
+    May be repeated, or given as a list in the config file.
+    example: -tags-map='cmd/...=integration' -tags-map='internal/db=db,e2e'
+    default: ''
+
+  -retries
+    How many more times to run go test for a package whose tests fail before
+    marking it as failed, each attempt with its own -timeout. The coverage of
+    the passing attempt is used and every retry is logged.
+    example: -retries=2
+    default:0
+
+  -retry-backoff
+    How long to wait before each retry, for tests failing again right away
+    on ports or databases still held by the last attempt. The wait ends
+    early when the run is canceled or times out, without retrying.
+    example: -retry-backoff=2s
+    default: no wait
+
+  -retry-exponential
+    Double -retry-backoff after each retry of a package, so with
+    -retry-backoff=2s the retries wait 2s, 4s, 8s and so on.
+    example: -retry-exponential
+    default:false
+
+  -json
+    Print a JSON object describing the run to stdout once the merged
+    coverprofile is written, with each package's path, coverage, pass or fail
+    status, attempts and duration in seconds. All other output goes to stderr.
+    Can not be used with -output=-.
+    example: -json
+    default:false
+
+  -merge
+    An existing coverprofile, such as one from another CI job, whose blocks
+    are merged into the output. Counts of blocks found in both are summed. Its
+    covermode must match -covermode.
+    example: -merge=unit.coverprofile
+    default: ''
+
+  -quiet
+    Do not print which package is being tested or the go test output of
+    passing packages, only failures and the summary.
+    example: -quiet
+    default:false
+
+  -quiet-go
+    Only print the go test output of failing packages, as -quiet does, but
+    still print which package is being tested. The output of each package is
+    printed at once when it fails, not mixed with that of the others.
+    example: -quiet-go
+    default:false
+
+  -progress
+    When printing to a terminal, keep a "tested X/Y packages" line at the
+    bottom, updated as each package finishes, and print only the go test
+    output of failing packages as with -quiet, unless -debug is given.
+    Otherwise, or with -log-format=json, it has no effect.
+    example: -progress
+    default:false
+
+  -keep-profiles
+    Leave the -profile-name file go test writes in each package directory,
+    which is otherwise removed once merged.
+    example: -keep-profiles
+    default:false
+
+  -global-timeout
+    Stop the whole run after this long, killing the packages still being
+    tested and writing the coverage collected so far, then exit with status 3.
+    Unlike -timeout this bounds the total time regardless of package count.
+    example: -global-timeout=30m
+    default: no limit
+
+  -watch
+    Keep running, testing the project again each time one of its .go files
+    is added, changed or removed, until interrupted. Only the packages with
+    changed files, and those importing them, are tested again, the others
+    keeping their last coverage so the coverprofile is always complete, or
+    every package with -coverpkg. -progress is not shown while watching.
+    example: -watch
+    default:false
+
+  -gocmd
+    The go command used to run the tests, such as a specific toolchain or a
+    wrapper script, instead of the go on the PATH. It must be found before
+    anything is tested, -debug printing the version it reports.
+    example: -gocmd=/usr/local/go1.21/bin/go
+    default: go
+
+  -mod
+    The -mod passed to go test for modules, one of readonly, vendor or mod,
+    overriding any -mod in GOFLAGS. GOFLAGS is otherwise honored, as by
+    every go command. It is not passed for projects resolved via GOPATH.
+    -debug prints the module mode in effect.
+    example: -mod=vendor
+    default: ''
+
+  -short
+    Run go test with -short, skipping the long tests that check
+    testing.Short(). Combines with -race and -tags.
+    example: -short
+    default:false
+
+  -use-gitignore
+    Also skip the directories ignored by the .gitignore files in the project,
+    on top of -ignore.
+    example: -use-gitignore
+    default:false
+
+  -fail-fast
+    Stop once a package fails, killing the packages still being tested and
+    writing the coverage collected so far. By default every package is tested
+    and all failures are reported.
+    example: -fail-fast
+    default:false
+
+  -max-failures
+    Stop as -fail-fast does once this many packages have failed, past which
+    the run is clearly broken, rather than at the first. 0 means no limit.
+    example: -max-failures=5
+    default:0
+
+  -json-events
+    Run go test with -json and count the tests of each package that passed,
+    failed and were skipped, printed after its coverage in the summary. The
+    output is still printed as text and coverage collected as usual.
+    example: -json-events
+    default:false
+
+  -cpu
+    Comma separated GOMAXPROCS values passed to go test as -cpu. Each
+    package's tests run once per value, and per -count if given after --, all
+    recorded in the single profile go test writes, so count mode sums them.
+    example: -cpu=1,2,4
+    default: ''
+
+  -cobertura
+    Also write the merged coverage as a Cobertura XML report, for CI systems
+    that show coverage in that format.
+    example: -cobertura=coverage.xml
+    default: ''
+
+  -lcov
+    Also write the merged coverage as an lcov tracefile, with a line record
+    for each line a statement starts on, read from the source files, for
+    editors and tools showing coverage in that format.
+    example: -lcov=coverage.info
+    default: ''
+
+  -count
+    Passed to go test as -count. Go caches test results, replaying the cached
+    coverprofile of unchanged packages; -count=1 bypasses the cache so every
+    package is tested afresh, which is slower, especially on large projects.
+    example: -count=1
+    default: go test's default, cached results are used
+
+  -allow-empty
+    Exit successfully when no packages are tested. Otherwise a run that tests
+    nothing, say because of a typo in -project or -include, exits with
+    status 4.
+    example: -allow-empty
+    default:false
+
+  -log-format
+    The format of overalls' output, text or json. With json every message,
+    including the go test output, and every package starting, passing or
+    failing is logged as one JSON object per line, with its level.
+    example: -log-format=json
+    default: text
+
+  -slowest
+    After the run print this many of the packages that took longest to test,
+    slowest first, with their durations including retries. Failed packages
+    are listed too.
+    example: -slowest=10
+    default: 0, not printed
+
+  -prefix-replace
+    Replace the prefix of each file path in the merged coverprofile, given
+    as old=new, so a profile generated in a container matches the source
+    tree it is uploaded from. Paths not starting with old are left as is.
+    example: -prefix-replace=/go/src/github.com/org/repo/=github.com/org/repo/
+    default: ''
+
+  -verbose-tests
+    Run go test with -v, printing the output of every test line by line as
+    it runs. This is independent of -debug, which only controls overalls'
+    own messages.
+    example: -verbose-tests
+    default:false
+
+  -profile-name
+    The file name of the coverprofile go test writes in each package
+    directory before it is merged, for when a package has a file of that
+    name or other tooling writes one. Must not contain a path separator.
+    example: -profile-name=.overalls-profile.out
+    default: 'profile.coverprofile'
+
+  -html
+    Also write the merged coverage as an HTML report, as 'go tool cover -html'
+    does, to browse the covered source. Failing to write it is reported but
+    the coverprofile is still written.
+    example: -html=coverage.html
+    default: ''
+
+  -env
+    An environment variable, as KEY=VALUE, set for each go test invocation on
+    top of overalls' own environment. May be repeated, the last of duplicate
+    keys is used. In a config file it is a list.
+    example: -env=DB_URL=postgres://localhost/test?sslmode=disable -env=STAGE=ci
+    default: ''
+
+  -fresh-cache
+    Point GOCACHE at a new temporary directory for the run, removed once it is
+    done, so nothing is replayed from a shared or stale build cache and your
+    own is left untouched. Every package is then built from scratch. It
+    takes precedence over a GOCACHE given with -env.
+    example: -fresh-cache
+    default:false
+
+  -coveralls
+    Post the merged coverage to Coveralls with this repo token once it is
+    written, along with the commit and branch checked out in the project.
+    File names are sent relative to the project's git repository. Nothing is
+    posted unless this or the COVERALLS_TOKEN environment variable is set.
+    example: -coveralls=$COVERALLS_REPO_TOKEN
+    default: $COVERALLS_TOKEN
+
+  -cpuprofile, -memprofile, -blockprofile
+    File names passed to go test with the flag of the same name. Each is
+    written in every tested package's directory, next to the test binary
+    go test keeps to read it with, and left there. They multiply what a run
+    writes by the number of packages and slow the tests down, so are meant
+    for targeted runs, say of one package with -include.
+    example: -cpuprofile=cpu.pprof -include=internal/parser
+    default: ''
+
+  -exclude-files
+    A comma separated list of files, such as generated code, whose coverage
+    is left out of the merged coverprofile, summary and reports. Patterns
+    take the same forms as -ignore but match the file's import path, globs
+    also matching its name. The packages tested are unaffected.
+    example: -exclude-files=*.pb.go,mock_*.go
+    default: ''
+
+  -parallel
+    Passed to go test as -parallel, the maximum number of tests calling
+    t.Parallel that run at the same time within one package. It does not
+    change how many packages are tested at once, that is -concurrency, so up
+    to -concurrency times -parallel tests may run together.
+    example: -parallel=4
+    default: GOMAXPROCS, go test's own default
+
+  -baseline
+    A coverprofile to compare the coverage with, such as the -output of a
+    run on the target branch. The change of each package and the total is
+    printed after the summary, followed by each line a statement starts on
+    left uncovered that the baseline covered or did not have, as file:line
+    or file:first-last.
+    Lines are matched by number, so code moved since shows up too.
+    example: -baseline=main.coverprofile
+    default: ''
+
+  -fail-on-decrease
+    Exit with an error when the total coverage is below that of -baseline.
+    example: -baseline=main.coverprofile -fail-on-decrease
+    default:false
+
+  -list-packages
+    Print the import path of each package that would be tested, one per line
+    and nothing else, without running go test or writing a coverprofile.
+    -ignore, -include and -tags apply as for a run. Unlike -dry-run it is
+    meant for other programs to read.
+    example: -list-packages | xargs go vet
+    default:false
+
+  -allow-build-failures
+    Quarantine packages that fail to build, as happens mid-refactor: they
+    are reported at the end, and in -json, but neither stop the run with
+    -fail-fast nor make it exit with an error. Packages whose tests fail
+    still do.
+    example: -allow-build-failures
+    default:false
+
+  -testflags
+    Flags passed to go test, before any given after --, split into
+    arguments as a shell would: quote arguments with spaces and escape
+    quotes with a backslash. Unlike -- it can be set in the config file.
+    Flags taking a value may be given as -run=TestA or -run TestA, and
+    any from -args on are passed to the test binary.
+    example: -testflags="-run='TestA|TestB' -failfast"
+    default: ''
+
+  -output-mode
+    The mode line written to the merged coverprofile, one of set, count or
+    atomic, for tools that expect a particular one. The counts are written
+    as go test recorded them, so a warning is printed when it differs from
+    the -covermode.
+    example: -output-mode=set
+    default: the -covermode
+
+  -changed-since
+    Only test the packages holding a file changed since this git ref, as
+    listed by git diff, so committed or not but not untracked. A file below
+    testdata counts for the package holding it. When git can't tell, say
+    for an unknown ref, every package is tested with a warning. When
+    nothing changed nothing is tested, pass -allow-empty to succeed then.
+    example: -changed-since=origin/main
+    default: ''
+
+  -changed-dependents
+    With -changed-since, also test the packages of the project that import
+    a changed package, directly or not, or whose tests do.
+    example: -changed-since=origin/main -changed-dependents
+    default:false
+
+  -require-tests
+    Fail the run when a package has Go files but no test files, listing
+    them at the end, to enforce that every package has tests. Directories
+    left out by -ignore, -include or -changed-since are not checked.
+    example: -require-tests
+    default:false
+
+  -split-output
+    Also write each package's coverprofile, as go test wrote it, to the
+    directory at its import path with '.coverprofile' appended, for tooling
+    analyzing coverage per package or module. Profiles of earlier runs are
+    overwritten but not removed.
+    example: -split-output=coverage
+    default: ''
+
+  -prebuild
+    Run 'go build ./...' or 'go vet ./...' in each project directory before
+    testing, with -tags, -mod and -env, stopping with go's output when it
+    fails, so a compile error is reported once rather than by every package
+    depending on it. vet also compiles the test files, and fails on its own
+    findings. -ignore does not apply.
+    example: -prebuild=vet
+    default: ''
+`
+)
+
+// flags holds the value of each command line flag.
+type flags struct {
+	ignore      string
+	skipVendor  bool
+	skipIncomp  bool
+	maxDepth    int
+	project     string
+	root        string
+	cover       string
+	help        bool
+	debug       bool
+	concurrency int
+	parallel    int
+	timeout     time.Duration
+	testTimeout time.Duration
+	global      time.Duration
+	goCmd       string
+	mod         string
+	prebuild    string
+	short       bool
+	verbose     bool
+	gitignore   bool
+	failFast    bool
+	maxFailures int
+	jsonEvents  bool
+	cpu         string
+	cobertura   string
+	lcov        string
+	html        string
+	split       string
+	coveralls   string
+	count       int
+	allowEmpty  bool
+	allowBuild  bool
+	requireTest bool
+	logFormat   string
+	slowest     int
+	prefix      string
+	output      string
+	outputMode  string
+	coverpkg    string
+	failUnder   float64
+	baseline    string
+	failDecr    bool
+	noSummary   bool
+	summarySort string
+	race        bool
+	strictCover bool
+	config      string
+	include     string
+	changed     string
+	dependents  bool
+	exclude     string
+	dryRun      bool
+	list        bool
+	tags        string
+	retries     int
+	retryWait   time.Duration
+	retryExp    bool
+	json        bool
+	merge       string
+	quiet       bool
+	quietGo     bool
+	progress    bool
+	watch       bool
+	keep        bool
+	env         listFlag
+	freshCache  bool
+	tagsMap     listFlag
+	packageMin  listFlag
+	testFlags   string
+	profile     string
+	cpuProfile  string
+	memProfile  string
+	blkProfile  string
+}
+
+// newFlagSet returns the flag set of the command line, each flag setting
+// its field of f.
+func newFlagSet(f *flags) *flag.FlagSet {
+	fs := flag.NewFlagSet("overalls", flag.ContinueOnError)
+	fs.StringVar(&f.project, "project", "", "comma separated project `paths`, relative to the '$GOPATH/src' directory")
+	fs.StringVar(&f.root, "root", "", "the directory of -project to walk, -project then being only its import path")
+	fs.StringVar(&f.cover, "covermode", "", "mode to run when testing files")
+	fs.StringVar(&f.ignore, "ignore", strings.Join(overalls.DefaultIgnores, ","), "comma separated list of directory names to ignore")
+	fs.BoolVar(&f.skipVendor, "skip-vendor", true, "skip vendor directories at any depth, whatever -ignore")
+	fs.BoolVar(&f.skipIncomp, "skip-incompatible", false, "skip packages whose files are all excluded by build constraints, as go list finds with -env and -tags")
+	fs.IntVar(&f.maxDepth, "max-depth", 0, "skip directories more than `n` levels below the project, 0 for no limit")
+	fs.BoolVar(&f.debug, "debug", false, "print debug output, such as each go test command")
+	fs.StringVar(&f.logFormat, "log-format", "text", "`format` of the log, text or json for one JSON object per line")
+	fs.BoolVar(&f.quiet, "quiet", false, "only print the go test output of failing packages and the summary")
+	fs.BoolVar(&f.quietGo, "quiet-go", false, "only print the go test output of failing packages, still printing which package is being tested")
+	fs.BoolVar(&f.progress, "progress", false, "show how many packages are tested so far, when printing to a terminal")
+	fs.IntVar(&f.concurrency, "concurrency", runtime.NumCPU(), "maximum number of packages to test at the same time")
+	fs.IntVar(&f.parallel, "parallel", 0, "passed to go test, maximum number of t.Parallel tests run at the same time within a package")
+	fs.DurationVar(&f.timeout, "timeout", 0, "passed to go test, packages running longer than this plus a minute are killed")
+	fs.DurationVar(&f.testTimeout, "go-test-timeout", 0, "passed to go test as -timeout instead, -timeout then being when packages are killed")
+	fs.BoolVar(&f.watch, "watch", false, "test again each time a .go file of the project changes, until interrupted")
+	fs.DurationVar(&f.global, "global-timeout", 0, "stop the whole run after this long, writing collected coverage")
+	fs.StringVar(&f.output, "output", "", "`path` of the file to write the merged coverprofile to")
+	fs.StringVar(&f.outputMode, "output-mode", "", "mode line written to the merged coverprofile, defaults to the covermode")
+	fs.StringVar(&f.cobertura, "cobertura", "", "also write the coverage as a Cobertura XML report to `path`")
+	fs.StringVar(&f.lcov, "lcov", "", "also write the coverage as an lcov tracefile to `path`")
+	fs.StringVar(&f.prefix, "prefix-replace", "", "rewrite the file path prefix `old=new` in the coverprofile")
+	fs.StringVar(&f.coveralls, "coveralls", "", "post the coverage to Coveralls with this repo `token`, defaults to $COVERALLS_TOKEN")
+	fs.StringVar(&f.html, "html", "", "also write the coverage as an HTML report to `path` using go tool cover")
+	fs.StringVar(&f.split, "split-output", "", "also write each package's coverprofile to `dir`/<import path>.coverprofile")
+	fs.StringVar(&f.merge, "merge", "", "existing coverprofile to merge into the output")
+	fs.BoolVar(&f.keep, "keep-profiles", false, "leave each package's coverprofile in its directory")
+	fs.StringVar(&f.profile, "profile-name", "", "file name of the coverprofile go test writes in each package directory")
+	fs.StringVar(&f.cpuProfile, "cpuprofile", "", "passed to go test, written in each package directory")
+	fs.StringVar(&f.memProfile, "memprofile", "", "passed to go test, written in each package directory")
+	fs.StringVar(&f.blkProfile, "blockprofile", "", "passed to go test, written in each package directory")
+	fs.StringVar(&f.coverpkg, "coverpkg", "", "passed to go test to measure coverage across packages")
+	fs.Float64Var(&f.failUnder, "fail-under", 0, "exit with an error when total coverage is below this")
+	fs.Var(&f.packageMin, "package-min", "exit with an error when a package matching the `pattern=percent` is below that coverage, may be repeated")
+	fs.StringVar(&f.baseline, "baseline", "", "coverprofile to compare the coverage with")
+	fs.BoolVar(&f.failDecr, "fail-on-decrease", false, "exit with an error when total coverage is below the -baseline")
+	fs.BoolVar(&f.noSummary, "no-summary", false, "do not print the coverage summary table")
+	fs.StringVar(&f.summarySort, "summary-sort", "path", "order of the coverage summary table, coverage putting the least covered first")
+	fs.IntVar(&f.slowest, "slowest", 0, "print the `n` packages that took longest to test")
+	fs.BoolVar(&f.race, "race", false, "run go test with the race detector")
+	fs.BoolVar(&f.strictCover, "strict-covermode", false, "fail rather than use atomic when -race is given another covermode")
+	fs.IntVar(&f.count, "count", 0, "passed to go test, 1 bypasses the test cache")
+	fs.StringVar(&f.cpu, "cpu", "", "GOMAXPROCS values passed to go test")
+	fs.BoolVar(&f.short, "short", false, "run go test with -short")
+	fs.BoolVar(&f.verbose, "verbose-tests", false, "run go test with -v")
+	fs.StringVar(&f.config, "config", "", "JSON file of flag values, defaults to '"+configFilename+"' in the project or current directory")
+	fs.BoolVar(&f.gitignore, "use-gitignore", false, "also skip directories ignored by the project's .gitignore files")
+	fs.StringVar(&f.include, "include", "", "comma separated list of directories to test, all when empty")
+	fs.StringVar(&f.changed, "changed-since", "", "only test packages with files changed since the git `ref`")
+	fs.BoolVar(&f.dependents, "changed-dependents", false, "with -changed-since also test the packages importing those changed")
+	fs.StringVar(&f.exclude, "exclude-files", "", "comma separated list of files left out of the coverage")
+	fs.BoolVar(&f.allowEmpty, "allow-empty", false, "succeed when no packages are tested")
+	fs.BoolVar(&f.allowBuild, "allow-build-failures", false, "report packages that fail to build without failing the run")
+	fs.BoolVar(&f.requireTest, "require-tests", false, "fail the run when a package has no test files")
+	fs.BoolVar(&f.dryRun, "dry-run", false, "print the packages that would be tested without testing them")
+	fs.BoolVar(&f.list, "list-packages", false, "print only the import path of each package that would be tested, one per line")
+	fs.StringVar(&f.tags, "tags", "", "build tags passed to go test")
+	fs.BoolVar(&f.failFast, "fail-fast", false, "stop testing once a package fails")
+	fs.IntVar(&f.maxFailures, "max-failures", 0, "stop testing once `n` packages fail, 0 for no limit")
+	fs.BoolVar(&f.jsonEvents, "json-events", false, "run go test with -json and print how many tests of each package passed, failed and were skipped")
+	fs.IntVar(&f.retries, "retries", 0, "times to re-run go test for a failing package")
+	fs.DurationVar(&f.retryWait, "retry-backoff", 0, "wait this long before each retry")
+	fs.BoolVar(&f.retryExp, "retry-exponential", false, "double -retry-backoff after each retry of a package")
+	fs.BoolVar(&f.json, "json", false, "print a JSON description of each tested package to stdout")
+	fs.StringVar(&f.testFlags, "testflags", "", "go test flags, split as a shell would, passed before any after --")
+	fs.Var(&f.env, "env", "`KEY=VALUE` environment variable set for go test, may be repeated")
+	fs.BoolVar(&f.freshCache, "fresh-cache", false, "build and test with an empty GOCACHE, removed after the run")
+	fs.Var(&f.tagsMap, "tags-map", "`pattern=tags` giving the build tags of the packages matching it instead of -tags, may be repeated")
+	fs.StringVar(&f.goCmd, "gocmd", "go", "go command used to run the tests")
+	fs.StringVar(&f.prebuild, "prebuild", "", "run go build or go vet on every package before testing")
+	fs.StringVar(&f.mod, "mod", "", "-mod passed to go for modules, overriding GOFLAGS")
+	fs.BoolVar(&f.help, "help", false, "print the help")
+
+	return fs
+}
+
+func init() {
+	// Verbose logging with file name and line number
+	log.SetFlags(log.Lshortfile)
+}
+
+func main() {
+	os.Exit(exitStatus(run(context.Background(), os.Args[1:], os.Stdout, os.Stderr)))
+}
+
+// exitError is returned by run for a failure with an exit status other than
+// 1, the status of any other error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// exitStatus returns the exit status for the error returned by run.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exit *exitError
+	if errors.As(err, &exit) {
+		return exit.code
+	}
+
+	return 1
+}
+
+// run runs overalls with the command line args. The -help and a
+// coverprofile or -json report are written to stdout, the progress and
+// summary too unless stdout is taken by either, when they go to stderr.
+// What go test writes to stderr goes there too, except with -progress or
+// -log-format=json.
+// Invalid flags are always reported on stderr, along with the help when no
+// project is given, so piping the help never hides an error. Why a run
+// failed is printed before its error is returned, main only needs to exit.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	f, opts, err := parseFlags(args, stderr)
+
+	// the flag set has already printed the error and usage
+	if _, ok := err.(parseError); ok {
+		return &exitError{code: 2, err: err}
+	}
+
+	if err == nil && f.help {
+		help(stdout)
+		return nil
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "\n**%s\n", err)
+		if err == errNoProject {
+			help(stderr)
+		}
+		return err
+	}
+
+	// out receives everything but a coverprofile or -json report written to
+	// stdout, it is stderr when either is so stdout can be piped.
+	out := stdout
+	if f.output == "-" || f.json {
+		out = stderr
+	}
+
+	// only the packages go to stdout, for other programs to read
+	if f.list {
+		opts.Logger = log.New(stderr, "", 0)
+
+		packages, err := overalls.List(ctx, opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "\n**%s\n", err)
+			return err
+		}
+
+		for _, p := range packages {
+			fmt.Fprintln(stdout, p)
+		}
+
+		return nil
+	}
+
+	// each package would fail on its own otherwise, once the walk started
+	goPath, err := lookGo(f.goCmd)
+	if err != nil {
+		fmt.Fprintf(stderr, "\n**%s\n", err)
+		return err
+	}
+
+	logger := log.New(out, "", log.LstdFlags)
+
+	var jl *jsonLog
+	if f.logFormat == "json" {
+		jl = newJSONLog(out)
+		logger = log.New(jl, "", 0)
+		opts.OnEvent = jl.event
+	}
+
+	// counted up front for the total, the walk starting packages as it goes
+	var pr *progress
+	if f.progress && jl == nil && !f.dryRun && !f.watch && isTerminal(out) {
+		if packages, err := overalls.List(ctx, opts); err == nil {
+			pr = newProgress(out, len(packages))
+			logger = log.New(pr, "", log.LstdFlags)
+			opts.OnEvent = pr.event
+			opts.Quiet = opts.Quiet || !f.debug
+		}
+	}
+
+	// go test's errors are kept apart, unless they would break up the JSON
+	// or progress lines
+	if jl == nil && pr == nil {
+		opts.ErrLogger = log.New(stderr, "", log.LstdFlags)
+	}
+
+	opts.Logger = logger
+	opts.Stdout = stdout
+
+	if f.debug {
+		logger.Println("Go version:", goVersion(goPath))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	if f.global > 0 {
+		ctx, cancel = context.WithTimeout(ctx, f.global)
+	}
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Printf("\n**received %s, stopping tests and writing collected coverage\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if f.watch {
+		err := overalls.Watch(ctx, opts, func(res overalls.Result, err error) {
+			report(f, res, err, stdout, out, logger, jl)
+		})
+
+		// interrupting is how watching ends
+		if err == context.Canceled {
+			return nil
+		}
+
+		if err == context.DeadlineExceeded {
+			logger.Printf("\n**-global-timeout of %s exceeded, stopped watching\n", f.global)
+			return &exitError{code: 3, err: err}
+		}
+
+		if err != nil {
+			logger.Printf("\n**%s\n", err)
+		}
+		return err
+	}
+
+	res, err := overalls.RunContext(ctx, opts)
+
+	if pr != nil {
+		pr.finish()
+	}
+
+	return report(f, res, err, stdout, out, logger, jl)
+}
+
+// report prints the outcome of a run, res and err, as configured by f and
+// returns the error to exit with. out and logger receive what is not the
+// -json report written to stdout, through jl with -log-format=json.
+func report(f *flags, res overalls.Result, err error, stdout, out io.Writer, logger *log.Logger, jl *jsonLog) error {
+	if !f.noSummary && len(res.Output) > 0 {
+		res.Summary = sortSummary(res.Summary, f.summarySort)
+
+		if jl != nil {
+			jl.summary(res)
+		} else {
+			printSummary(out, res, f.jsonEvents)
+		}
+	}
+
+	if res.Delta != nil {
+		if jl != nil {
+			jl.delta(res)
+		} else {
+			printDelta(out, res)
+		}
+	}
+
+	if f.slowest > 0 && len(res.Packages) > 0 {
+		if jl != nil {
+			jl.slowest(res.Slowest(f.slowest))
+		} else {
+			printSlowest(out, res.Slowest(f.slowest))
+		}
+	}
+
+	if f.json {
+		if err := writeJSON(stdout, res); err != nil {
+			logger.Printf("\n**unable to write JSON: %s\n", err)
+			return err
+		}
+	}
+
+	if err == context.Canceled {
+		logger.Printf("\n**interrupted, partial coverage written to '%s'\n", res.Output)
+		return err
+	}
+
+	// a distinct exit code so CI can tell a run out of time from failures
+	if err == context.DeadlineExceeded {
+		logger.Printf("\n**-global-timeout of %s exceeded, partial coverage written to '%s'\n", f.global, res.Output)
+		return &exitError{code: 3, err: err}
+	}
+
+	if err == overalls.ErrPrebuildFailed {
+		logger.Printf("\n**-prebuild=%s failed, nothing was tested\n", f.prebuild)
+		return err
+	}
+
+	if err == overalls.ErrPackagesFailed {
+		failed := res.Failed()
+
+		built := 0
+		for _, p := range failed {
+			if !p.BuildFailed {
+				built++
+			}
+		}
+
+		// build failures need fixing before the tests can say anything
+		if built < len(failed) {
+			logger.Printf("\n**%d package(s) failed to build, %d package(s) had failing tests\n", len(failed)-built, built)
+		} else {
+			logger.Printf("\n**%d package(s) failed\n", len(failed))
+		}
+		for _, p := range failed {
+			logger.Printf("  %s (exit %d): %s\n", p.ImportPath, p.ExitCode, p.Err)
+		}
+		return err
+	}
+
+	// the run didn't fail for them, but they still need fixing
+	if f.allowBuild {
+		var quarantined []overalls.PackageResult
+		for _, p := range res.Failed() {
+			if p.BuildFailed {
+				quarantined = append(quarantined, p)
+			}
+		}
+
+		if len(quarantined) > 0 {
+			logger.Printf("\n**%d package(s) failed to build and were quarantined\n", len(quarantined))
+			for _, p := range quarantined {
+				logger.Printf("  %s (exit %d): %s\n", p.ImportPath, p.ExitCode, p.Err)
+			}
+		}
+	}
+
+	if err == overalls.ErrUntestedPackages {
+		logger.Printf("\n**%d package(s) have no test files\n", len(res.Untested))
+		for _, pkg := range res.Untested {
+			logger.Printf("  %s\n", pkg)
+		}
+		return err
+	}
+
+	if err == overalls.ErrCoverageTooLow {
+		logger.Printf("\n**total coverage %.1f%% is below -fail-under %.1f%%\n", res.Coverage, f.failUnder)
+		return err
+	}
+
+	if err == overalls.ErrPackageCoverageTooLow {
+		logger.Printf("\n**%d package(s) below their minimum coverage\n", len(res.BelowMinimum))
+		for _, p := range res.BelowMinimum {
+			logger.Printf("  %s: %.1f%% is below %.1f%%\n", p.Package, p.Coverage, p.Minimum)
+		}
+		return err
+	}
+
+	if err == overalls.ErrCoverageDecreased {
+		logger.Printf("\n**total coverage %.1f%% is below the -baseline %.1f%%\n", res.Coverage, res.Delta.Baseline)
+		return err
+	}
+
+	if err == overalls.ErrNoPackages {
+		logger.Println("\n**no packages were tested, check -project, -ignore and -include or pass -allow-empty")
+		return &exitError{code: 4, err: err}
+	}
+
+	if err != nil {
+		logger.Printf("\n**%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// lookGo returns the path of the go command gocmd, or an error saying how to
+// fix it when it can't be found.
+func lookGo(gocmd string) (string, error) {
+	path, err := exec.LookPath(gocmd)
+	if err != nil {
+		return "", fmt.Errorf("go command '%s' not found, install Go or set -gocmd to its path\n%s", gocmd, err)
+	}
+
+	return path, nil
+}
+
+// goVersion returns the version the go command at path reports, such as
+// 'go1.16.3 linux/amd64', which a wrapper script may not.
+func goVersion(path string) string {
+	b, err := exec.Command(path, "version").Output()
+	if err != nil {
+		return fmt.Sprintf("unknown, %s", err)
+	}
+
+	return strings.TrimPrefix(strings.TrimSpace(string(b)), "go version ")
+}
+
+// printSummary prints to out the statement coverage of each package and the total,
+// similar to go test -cover. With tests, how many tests of each package
+// passed, failed and were skipped follows its coverage.
+func printSummary(out io.Writer, res overalls.Result, tests bool) {
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	counts := map[string]overalls.TestCounts{}
+	for _, p := range res.Packages {
+		counts[p.ImportPath] = p.Tests
+	}
+
+	fmt.Fprintln(tw)
+	for _, p := range res.Summary {
+		fmt.Fprintf(tw, "%s\tcoverage: %.1f%% of statements", p.Package, p.Coverage)
+		if c, ok := counts[p.Package]; tests && ok {
+			fmt.Fprintf(tw, "\t%d passed, %d failed, %d skipped", c.Passed, c.Failed, c.Skipped)
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "total\tcoverage: %.1f%% of statements\n", res.Coverage)
+
+	tw.Flush()
+}
+
+// sortSummary returns a copy of summary, sorted by import path, ordered by
+// by: path keeps it so, coverage puts the least covered packages first and
+// name sorts by the last element of the import path. Ties stay by path.
+func sortSummary(summary []overalls.PackageCoverage, by string) []overalls.PackageCoverage {
+	sorted := append([]overalls.PackageCoverage(nil), summary...)
+
+	switch by {
+	case "coverage":
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Coverage < sorted[j].Coverage })
+	case "name":
+		sort.SliceStable(sorted, func(i, j int) bool { return path.Base(sorted[i].Package) < path.Base(sorted[j].Package) })
+	}
+
+	return sorted
+}
+
+// printDelta prints to out the change in coverage of each package and the
+// total since the baseline, followed by the newly uncovered lines.
+func printDelta(out io.Writer, res overalls.Result) {
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "\nchange since baseline")
+	for _, p := range res.Delta.Packages {
+		fmt.Fprintf(tw, "%s\t%+.1f%%\t%.1f%% -> %.1f%%\n", p.Package, p.Change, p.Baseline, p.Coverage)
+	}
+	fmt.Fprintf(tw, "total\t%+.1f%%\t%.1f%% -> %.1f%%\n", res.Delta.Change, res.Delta.Baseline, res.Coverage)
+
+	tw.Flush()
+
+	if len(res.Delta.Uncovered) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "\nnewly uncovered lines")
+	for _, r := range lineRanges(res.Delta.Uncovered) {
+		fmt.Fprintf(out, "  + %s\n", r)
+	}
+}
+
+// lineRanges returns lines, sorted by file and line, as file:line strings
+// with consecutive lines of a file joined into file:first-last.
+func lineRanges(lines []overalls.Line) []string {
+	var ranges []string
+
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1].File == lines[i].File && lines[j+1].Line == lines[j].Line+1 {
+			j++
+		}
+
+		if j == i {
+			ranges = append(ranges, fmt.Sprintf("%s:%d", lines[i].File, lines[i].Line))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%s:%d-%d", lines[i].File, lines[i].Line, lines[j].Line))
+		}
+
+		i = j + 1
+	}
+
+	return ranges
+}
+
+// printSlowest prints to out how long each of packages took to test, marking
+// those that failed.
+func printSlowest(out io.Writer, packages []overalls.PackageResult) {
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "\nslowest %d package(s)\n", len(packages))
+	for _, p := range packages {
+		status := ""
+		if p.Err != nil {
+			status = "\tFAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%.2fs%s\n", p.ImportPath, p.Duration.Seconds(), status)
+	}
+
+	tw.Flush()
+}
+
+// listFlag is a flag.Value collecting the value of each use of a repeatable
+// flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func help(w io.Writer) {
+	fmt.Fprint(w, helpString)
+}
+
+// errNoProject is returned by parseFlags when no -project is given and none
+// can be inferred from the current directory.
+var errNoProject = errors.New("invalid project path ''")
+
+// inferProject returns the project to test when no -project is given: the
+// current directory when it or a parent holds a go.mod, outside of GOPATH
+// mode, or its import path when it is within '$GOPATH/src'. An empty string
+// is returned when it is neither.
+func inferProject() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	// a go.mod in a parent makes the current directory a package of that
+	// module, as it would for the go command
+	if os.Getenv("GO111MODULE") != "off" {
+		for dir := wd; ; dir = filepath.Dir(dir) {
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				return "."
+			}
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+
+	for _, gopath := range filepath.SplitList(overalls.GoPath()) {
+		rel, err := filepath.Rel(filepath.Join(gopath, "src"), wd)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+
+	return ""
+}
+
+// parseError is returned by parseFlags for a command line the flag set could
+// not parse, it has printed the error itself.
+type parseError struct {
+	error
+}
+
+// parseFlags parses the command line args and any config file into the flags
+// and the Options to run overalls with. Errors parsing args are printed to
+// stderr, with the flags. -h and --help are taken as -help.
+func parseFlags(args []string, stderr io.Writer) (*flags, overalls.Options, error) {
+	f := &flags{}
+	fs := newFlagSet(f)
+	fs.SetOutput(stderr)
+
+	// the flag set prints its usage before returning flag.ErrHelp too, it
+	// is printed below for invalid flags only
+	fs.Usage = func() {}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			f.help = true
+			return f, overalls.Options{}, nil
+		}
+
+		fmt.Fprintln(stderr, "Usage of overalls, see -help for the details:")
+		fs.PrintDefaults()
+
+		return f, overalls.Options{}, parseError{err}
+	}
+
+	if f.help {
+		return f, overalls.Options{}, nil
+	}
+
+	config := f.config
+	if len(config) == 0 {
+		config = findConfig(strings.Split(f.project, ",")[0])
+	}
+
+	if len(config) > 0 {
+		if err := loadConfig(fs, config); err != nil {
+			return f, overalls.Options{}, err
+		}
+	}
+
+	// checked first so a bad covermode is reported before a missing project
+	if err := overalls.CheckCoverMode(f.cover, f.race, f.strictCover); err != nil {
+		return f, overalls.Options{}, err
+	}
+
+	if f.output == "-" && f.json {
+		return f, overalls.Options{}, errors.New("-json and -output=- can not both write to stdout")
+	}
+
+	// the current directory says nothing of the import path of another
+	if len(f.project) == 0 && len(f.root) == 0 {
+		f.project = inferProject()
+	}
+
+	if len(f.project) == 0 {
+		return f, overalls.Options{}, errNoProject
+	}
+
+	if f.concurrency < 1 {
+		return f, overalls.Options{}, fmt.Errorf("invalid concurrency '%d', must be at least 1", f.concurrency)
+	}
+
+	if f.slowest < 0 {
+		return f, overalls.Options{}, fmt.Errorf("invalid slowest '%d', must not be negative", f.slowest)
+	}
+
+	if f.retryWait < 0 {
+		return f, overalls.Options{}, fmt.Errorf("invalid retry-backoff '%s', must not be negative", f.retryWait)
+	}
+
+	for _, entry := range f.packageMin {
+		if err := overalls.CheckPackageMinimum(entry); err != nil {
+			return f, overalls.Options{}, err
+		}
+	}
+
+	switch f.mod {
+	case "", "readonly", "vendor", "mod":
+	default:
+		return f, overalls.Options{}, fmt.Errorf("invalid mod '%s', must be readonly, vendor or mod", f.mod)
+	}
+
+	if f.logFormat != "text" && f.logFormat != "json" {
+		return f, overalls.Options{}, fmt.Errorf("invalid log-format '%s', must be text or json", f.logFormat)
+	}
+
+	switch f.summarySort {
+	case "path", "coverage", "name":
+	default:
+		return f, overalls.Options{}, fmt.Errorf("invalid summary-sort '%s', must be path, coverage or name", f.summarySort)
+	}
+
+	testArgs, err := splitTestFlags(f.testFlags)
+	if err != nil {
+		return f, overalls.Options{}, err
+	}
+
+	// nothing is posted unless a token is given one way or the other
+	if len(f.coveralls) == 0 {
+		f.coveralls = os.Getenv("COVERALLS_TOKEN")
+	}
+
+	projects := strings.Split(f.project, ",")
+
+	return f, overalls.Options{
+		Project:            projects[0],
+		Projects:           projects[1:],
+		Root:               f.root,
+		CoverMode:          f.cover,
+		Race:               f.race,
+		StrictCoverMode:    f.strictCover,
+		Short:              f.short,
+		Verbose:            f.verbose,
+		CPU:                f.cpu,
+		Count:              f.count,
+		Ignores:            strings.Split(f.ignore, ","),
+		IncludeVendor:      !f.skipVendor,
+		SkipIncompatible:   f.skipIncomp,
+		MaxDepth:           f.maxDepth,
+		UseGitignore:       f.gitignore,
+		Includes:           strings.Split(f.include, ","),
+		ExcludeFiles:       strings.Split(f.exclude, ","),
+		ChangedSince:       f.changed,
+		ChangedDependents:  f.dependents,
+		Concurrency:        f.concurrency,
+		Parallel:           f.parallel,
+		FailFast:           f.failFast,
+		MaxFailures:        f.maxFailures,
+		JSONEvents:         f.jsonEvents,
+		Retries:            f.retries,
+		RetryBackoff:       f.retryWait,
+		RetryExponential:   f.retryExp,
+		Timeout:            f.timeout,
+		GoTestTimeout:      f.testTimeout,
+		Output:             f.output,
+		OutputMode:         f.outputMode,
+		Merge:              f.merge,
+		Cobertura:          f.cobertura,
+		Lcov:               f.lcov,
+		HTML:               f.html,
+		SplitOutput:        f.split,
+		CoverallsToken:     f.coveralls,
+		PrefixReplace:      f.prefix,
+		KeepProfiles:       f.keep,
+		ProfileName:        f.profile,
+		CPUProfile:         f.cpuProfile,
+		MemProfile:         f.memProfile,
+		BlockProfile:       f.blkProfile,
+		Tags:               f.tags,
+		CoverPkg:           f.coverpkg,
+		FailUnder:          f.failUnder,
+		Baseline:           f.baseline,
+		FailOnDecrease:     f.failDecr,
+		AllowEmpty:         f.allowEmpty,
+		AllowBuildFailures: f.allowBuild,
+		RequireTests:       f.requireTest,
+		DryRun:             f.dryRun,
+		GoCmd:              f.goCmd,
+		Mod:                f.mod,
+		Prebuild:           f.prebuild,
+		TestArgs:           append(testArgs, fs.Args()...),
+		Env:                f.env,
+		FreshCache:         f.freshCache,
+		TagsMap:            f.tagsMap,
+		PackageMinimums:    f.packageMin,
+		Quiet:              f.quiet,
+		QuietGo:            f.quietGo,
+		Debug:              f.debug,
+	}, nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/overalls"
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+const testFiles = "-project=github.com/go-playground/overalls/test-files"
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "all.coverprofile")
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err = run(context.Background(), []string{testFiles, "-output=" + output, "-include=good"}, stdout, stderr)
+	Equal(t, err, nil)
+	MatchRegex(t, stdout.String(), "github.com/go-playground/overalls/test-files/good +coverage: 100.0% of statements\n")
+	Equal(t, stderr.Len(), 0)
+
+	b, err := ioutil.ReadFile(output)
+	Equal(t, err, nil)
+	NotEqual(t, strings.Index(string(b), "test-files/good/main.go"), -1)
+
+	// stdout is left to the coverprofile
+	stdout.Reset()
+	err = run(context.Background(), []string{testFiles, "-output=-", "-include=good", "-no-summary"}, stdout, stderr)
+	Equal(t, err, nil)
+	MatchRegex(t, stdout.String(), "^mode: count\ngithub.com/go-playground/overalls/test-files/good/main.go:")
+	MatchRegex(t, stderr.String(), "Test package: github.com/go-playground/overalls/test-files/good")
+
+	stdout.Reset()
+	stderr.Reset()
+	err = run(context.Background(), []string{testFiles, "-list-packages", "-include=good*"}, stdout, stderr)
+	Equal(t, err, nil)
+	Equal(t, stdout.String(), "github.com/go-playground/overalls/test-files/good\ngithub.com/go-playground/overalls/test-files/good2\n")
+	Equal(t, stderr.Len(), 0)
+}
+
+func TestRun_Errors(t *testing.T) {
+	tests := []struct {
+		args   []string
+		status int
+		stdout string
+		stderr string
+	}{
+		{args: []string{"-help"}, status: 0, stdout: "usage: overalls"},
+		{args: []string{"-bogus"}, status: 2, stderr: "flag provided but not defined: -bogus\nUsage of overalls, see -help for the details:\n(.|\n)*  -lcov path\n"},
+		{args: []string{"-covermode=bad"}, status: 1, stderr: "\\*\\*invalid covermode 'bad', must be set, count or atomic\n"},
+		{args: []string{testFiles, "-race", "-covermode=set", "-strict-covermode"}, status: 1, stderr: "\\*\\*invalid covermode 'set', -race requires atomic\n"},
+		{args: []string{testFiles, "-concurrency=0"}, status: 1, stderr: "\\*\\*invalid concurrency '0', must be at least 1\n"},
+		{args: []string{testFiles, "-package-min=bogus"}, status: 1, stderr: "\\*\\*invalid package-min 'bogus', must be pattern=percent\n"},
+		{args: []string{testFiles, "-summary-sort=size"}, status: 1, stderr: "\\*\\*invalid summary-sort 'size', must be path, coverage or name\n"},
+		{args: []string{testFiles, "-retry-backoff=-1s"}, status: 1, stderr: "\\*\\*invalid retry-backoff '-1s', must not be negative\n"},
+		{args: []string{testFiles, "-mod=bogus"}, status: 1, stderr: "\\*\\*invalid mod 'bogus', must be readonly, vendor or mod\n"},
+		{args: []string{testFiles, "-json", "-output=-"}, status: 1, stderr: "\\*\\*-json and -output=- can not both write to stdout\n"},
+		{args: []string{testFiles, "-include=broken,good", "-tags=broken", "-allow-build-failures", "-no-summary"}, status: 0, stdout: "\\*\\*1 package\\(s\\) failed to build and were quarantined\n.*  github.com/go-playground/overalls/test-files/broken \\(exit 1\\)"},
+		{args: []string{testFiles, "-include=good,no-test-files", "-require-tests", "-no-summary"}, status: 1, stdout: "\\*\\*1 package\\(s\\) have no test files\n.*  github.com/go-playground/overalls/test-files/no-test-files\n"},
+		{args: []string{testFiles, "-gocmd=does-not-exist-go"}, status: 1, stderr: "\\*\\*go command 'does-not-exist-go' not found, install Go or set -gocmd to its path\n"},
+		{args: []string{testFiles, "-include=good", "-debug", "-no-summary"}, status: 0, stdout: "Go version: go[0-9.]+.* [a-z0-9]+/[a-z0-9]+\n"},
+		{args: []string{testFiles, "-include=good", "-tags=broken", "-prebuild=vet"}, status: 1, stdout: "broken_test.go(.|\n)*\\*\\*-prebuild=vet failed, nothing was tested\n"},
+		{args: []string{testFiles, "-include=broken,flaky,good", "-tags=broken,flaky", "-concurrency=1", "-max-failures=2", "-no-summary"}, status: 1, stdout: "-max-failures is 2\n(.|\n)*\\*\\*1 package\\(s\\) failed to build, 1 package\\(s\\) had failing tests\n"},
+		{args: []string{testFiles, "-include=good", "-json-events"}, status: 0, stdout: "test-files/good +coverage: 100.0% of statements +1 passed, 0 failed, 0 skipped\n"},
+		{args: []string{testFiles, "-include=broken", "-tags=broken", "-no-summary"}, status: 1, stdout: "\\*\\*1 package\\(s\\) failed to build", stderr: "broken_test.go:[0-9]+:[0-9]+: "},
+		{args: []string{testFiles, "-include=good", "-watch", "-global-timeout=5s"}, status: 3, stdout: "total +coverage: 100.0% of statements\n(.|\n)*Watching for changes to .go files\n(.|\n)*\\*\\*-global-timeout of 5s exceeded, stopped watching\n"},
+		{args: []string{testFiles, "-include=missing"}, status: 4, stdout: "\\*\\*no packages were tested"},
+		{args: []string{testFiles, "-include=flaky", "-tags=flaky", "-no-summary"}, status: 1, stdout: "\\*\\*1 package\\(s\\) failed\n"},
+	}
+
+	os.Setenv("OVERALLS_FLAKY_MARKER", filepath.Join(os.TempDir(), "overalls-run-errors-marker"))
+	defer os.Unsetenv("OVERALLS_FLAKY_MARKER")
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	for _, tt := range tests {
+		os.Remove(os.Getenv("OVERALLS_FLAKY_MARKER"))
+
+		// first, so a case's own -output wins
+		args := append([]string{"-output=" + filepath.Join(dir, "overalls.coverprofile")}, tt.args...)
+
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		err := run(context.Background(), args, stdout, stderr)
+		Equal(t, exitStatus(err), tt.status)
+
+		if len(tt.stdout) > 0 {
+			MatchRegex(t, stdout.String(), tt.stdout)
+		}
+		if len(tt.stderr) > 0 {
+			MatchRegex(t, stderr.String(), tt.stderr)
+		}
+	}
+
+	os.Remove(os.Getenv("OVERALLS_FLAKY_MARKER"))
+}
+
+// chdir changes the current directory to dir, returning a func changing it
+// back.
+func chdir(t *testing.T, dir string) func() {
+	wd, err := os.Getwd()
+	Equal(t, err, nil)
+	Equal(t, os.Chdir(dir), nil)
+
+	return func() { os.Chdir(wd) }
+}
+
+func TestRun_HelpAndErrorStreams(t *testing.T) {
+	// with nothing to infer the project from
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+	defer chdir(t, dir)()
+
+	// -help | less shows the whole help and nothing else, as do -h and
+	// --help
+	for _, arg := range []string{"-help", "-h", "--help"} {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		err = run(context.Background(), []string{arg}, stdout, stderr)
+		Equal(t, err, nil)
+		Equal(t, exitStatus(err), 0)
+		Equal(t, stdout.String(), helpString)
+		Equal(t, stderr.Len(), 0)
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	// an error, and the help printed with it, stay together on stderr
+	stdout.Reset()
+	err = run(context.Background(), []string{}, stdout, stderr)
+	Equal(t, err, errNoProject)
+	Equal(t, stdout.Len(), 0)
+	Equal(t, stderr.String(), "\n**invalid project path ''\n"+helpString)
+}
+
+func TestLineRanges(t *testing.T) {
+	lines := []overalls.Line{
+		{File: "a/a.go", Line: 3}, {File: "a/a.go", Line: 4}, {File: "a/a.go", Line: 5},
+		{File: "a/a.go", Line: 9},
+		{File: "b/b.go", Line: 10}, {File: "b/b.go", Line: 11},
+	}
+
+	Equal(t, lineRanges(lines), []string{"a/a.go:3-5", "a/a.go:9", "b/b.go:10-11"})
+	Equal(t, len(lineRanges(nil)), 0)
+}
+
+func TestPrintDelta(t *testing.T) {
+	res := overalls.Result{Coverage: 50, Delta: &overalls.Delta{
+		Baseline:  75,
+		Change:    -25,
+		Packages:  []overalls.PackageDelta{{Package: "example.com/a", Baseline: 75, Coverage: 50, Change: -25}},
+		Uncovered: []overalls.Line{{File: "example.com/a/a.go", Line: 7}},
+	}}
+
+	out := &bytes.Buffer{}
+	printDelta(out, res)
+	Equal(t, out.String(), "\nchange since baseline\n"+
+		"example.com/a  -25.0%  75.0% -> 50.0%\n"+
+		"total          -25.0%  75.0% -> 50.0%\n"+
+		"\nnewly uncovered lines\n"+
+		"  + example.com/a/a.go:7\n")
+}
+
+func TestSortSummary(t *testing.T) {
+	summary := []overalls.PackageCoverage{
+		{Package: "example.com/a/zeta", Coverage: 90},
+		{Package: "example.com/b/alpha", Coverage: 40},
+		{Package: "example.com/c/mid", Coverage: 90},
+	}
+
+	packages := func(pcs []overalls.PackageCoverage) []string {
+		var names []string
+		for _, p := range pcs {
+			names = append(names, p.Package)
+		}
+		return names
+	}
+
+	Equal(t, packages(sortSummary(summary, "path")), []string{"example.com/a/zeta", "example.com/b/alpha", "example.com/c/mid"})
+	Equal(t, packages(sortSummary(summary, "coverage")), []string{"example.com/b/alpha", "example.com/a/zeta", "example.com/c/mid"})
+	Equal(t, packages(sortSummary(summary, "name")), []string{"example.com/b/alpha", "example.com/c/mid", "example.com/a/zeta"})
+
+	// sorted as a copy
+	Equal(t, summary[0].Package, "example.com/a/zeta")
+}
+
+func TestParseFlags_InferProject(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(gopath)
+
+	// the temp dir may be reached through a symlink, as on macOS
+	gopath, err = filepath.EvalSymlinks(gopath)
+	Equal(t, err, nil)
+
+	defer func(path, module string) {
+		os.Setenv("GOPATH", path)
+		os.Setenv("GO111MODULE", module)
+	}(os.Getenv("GOPATH"), os.Getenv("GO111MODULE"))
+	os.Setenv("GOPATH", gopath)
+	os.Setenv("GO111MODULE", "")
+
+	pkg := filepath.Join(gopath, "src", "example.com", "infer")
+	mod := filepath.Join(gopath, "mod")
+	Equal(t, os.MkdirAll(pkg, 0755), nil)
+	Equal(t, os.MkdirAll(filepath.Join(mod, "sub"), 0755), nil)
+	Equal(t, ioutil.WriteFile(filepath.Join(mod, "go.mod"), []byte("module example.com/mod\n"), 0644), nil)
+
+	tests := []struct {
+		dir, project string
+		args         []string
+		err          error
+	}{
+		{dir: pkg, project: "example.com/infer"},
+		{dir: mod, project: "."},
+		{dir: filepath.Join(mod, "sub"), project: "."},
+		{dir: gopath, err: errNoProject},
+		{dir: filepath.Join(gopath, "src"), err: errNoProject},
+		{dir: pkg, args: []string{"-project=example.com/other"}, project: "example.com/other"},
+		{dir: pkg, args: []string{"-root=" + mod}, err: errNoProject},
+		{dir: pkg, args: []string{"-root=" + mod, "-project=example.com/mod"}, project: "example.com/mod"},
+	}
+
+	for _, tt := range tests {
+		undo := chdir(t, tt.dir)
+		_, opts, err := parseFlags(tt.args, ioutil.Discard)
+		undo()
+
+		Equal(t, err, tt.err)
+		Equal(t, opts.Project, tt.project)
+	}
+
+	// a go.mod is ignored in GOPATH mode
+	os.Setenv("GO111MODULE", "off")
+	defer chdir(t, mod)()
+
+	_, _, err = parseFlags(nil, ioutil.Discard)
+	Equal(t, err, errNoProject)
+}
+
+func TestParseFlags_SkipVendor(t *testing.T) {
+	_, opts, err := parseFlags([]string{testFiles}, ioutil.Discard)
+	Equal(t, err, nil)
+	Equal(t, opts.IncludeVendor, false)
+	Equal(t, opts.Ignores, []string{".git"})
+
+	// the rest of the ignore list is kept
+	_, opts, err = parseFlags([]string{testFiles, "-skip-vendor=false"}, ioutil.Discard)
+	Equal(t, err, nil)
+	Equal(t, opts.IncludeVendor, true)
+	Equal(t, opts.Ignores, []string{".git"})
+}
+
+func TestParseFlags_TagsMap(t *testing.T) {
+	_, opts, err := parseFlags([]string{testFiles, "-tags=a", "-tags-map=cmd/...=b,c", "-tags-map=internal=d"}, ioutil.Discard)
+	Equal(t, err, nil)
+	Equal(t, opts.Tags, "a")
+	Equal(t, opts.TagsMap, []string{"cmd/...=b,c", "internal=d"})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-playground/overalls"
+)
+
+// progress keeps a "tested X/Y packages" line at the bottom of a terminal,
+// updated as each package finishes. It is an io.Writer for a log.Logger,
+// each message being written above the line.
+type progress struct {
+	mu    sync.Mutex
+	w     io.Writer
+	done  int
+	total int
+}
+
+// newProgress returns a progress writing to w for a run testing total
+// packages.
+func newProgress(w io.Writer, total int) *progress {
+	return &progress{w: w, total: total}
+}
+
+// Write clears the progress line, writes the message p and redraws the line
+// below it.
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprint(p.w, "\r\033[K")
+
+	n, err := p.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+
+	p.draw()
+
+	return n, nil
+}
+
+// event counts the packages finished, for Options.OnEvent.
+func (p *progress) event(e overalls.Event) {
+	if e.Type == overalls.EventStart {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	p.draw()
+}
+
+// finish ends the progress line, for what is printed after the run.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) draw() {
+	fmt.Fprintf(p.w, "\rtested %d/%d packages", p.done, p.total)
+}
+
+// isTerminal reports whether w is a terminal rather than, say, a file or a
+// pipe read by other programs.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/go-playground/overalls"
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestProgress(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := newProgress(out, 2)
+	logger := log.New(p, "", 0)
+
+	p.event(overalls.Event{Type: overalls.EventStart})
+	Equal(t, out.Len(), 0)
+
+	p.event(overalls.Event{Type: overalls.EventDone})
+	Equal(t, out.String(), "\rtested 1/2 packages")
+
+	// messages are written above the line
+	out.Reset()
+	logger.Println("ERROR: failed")
+	Equal(t, out.String(), "\r\033[KERROR: failed\n\rtested 1/2 packages")
+
+	out.Reset()
+	p.event(overalls.Event{Type: overalls.EventFailed})
+	p.finish()
+	Equal(t, out.String(), "\rtested 2/2 packages\n")
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := ioutil.TempFile("", "overalls")
+	Equal(t, err, nil)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	Equal(t, isTerminal(f), false)
+	Equal(t, isTerminal(&bytes.Buffer{}), false)
+
+	// not a terminal, the output is as without -progress
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err = run(context.Background(), []string{testFiles, "-output=" + f.Name() + ".coverprofile", "-include=good", "-progress", "-no-summary"}, stdout, stderr)
+	defer os.Remove(f.Name() + ".coverprofile")
+	Equal(t, err, nil)
+	MatchRegex(t, stdout.String(), "Test package: github.com/go-playground/overalls/test-files/good\n")
+	NotMatchRegex(t, stdout.String(), "tested")
+}
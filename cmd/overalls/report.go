@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/go-playground/overalls"
+)
+
+// jsonReport is the -json description of a run.
+type jsonReport struct {
+	Output   string        `json:"output"`
+	Coverage float64       `json:"coverage"`
+	Packages []jsonPackage `json:"packages"`
+}
+
+// jsonPackage is the -json description of a single tested package.
+type jsonPackage struct {
+	Package     string  `json:"package"`
+	Coverage    float64 `json:"coverage"`
+	Passed      bool    `json:"passed"`
+	BuildFailed bool    `json:"build_failed,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	Attempts    int     `json:"attempts"`
+	ExitCode    int     `json:"exit_code"`
+	Duration    float64 `json:"duration"`
+}
+
+// writeJSON writes res to w as a JSON object, package durations are in
+// seconds.
+func writeJSON(w io.Writer, res overalls.Result) error {
+	report := jsonReport{
+		Output:   res.Output,
+		Coverage: res.Coverage,
+		Packages: make([]jsonPackage, 0, len(res.Packages)),
+	}
+
+	for _, p := range res.Packages {
+		jp := jsonPackage{
+			Package:     p.ImportPath,
+			Coverage:    p.Coverage,
+			Passed:      p.Err == nil,
+			BuildFailed: p.BuildFailed,
+			Attempts:    p.Attempts,
+			ExitCode:    p.ExitCode,
+			Duration:    p.Duration.Seconds(),
+		}
+		if p.Err != nil {
+			jp.Error = p.Err.Error()
+		}
+
+		report.Packages = append(report.Packages, jp)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(report)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-playground/overalls"
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestWriteJSON(t *testing.T) {
+	res := overalls.Result{
+		Output:   "/tmp/overalls.coverprofile",
+		Coverage: 50,
+		Packages: []overalls.PackageResult{
+			{ImportPath: "example.com/a", Coverage: 100, Attempts: 1, Duration: 1500 * time.Millisecond},
+			{ImportPath: "example.com/b", Attempts: 2, Duration: time.Second, ExitCode: 1, Err: errors.New("exit status 1")},
+			{ImportPath: "example.com/c", Attempts: 1, ExitCode: 1, BuildFailed: true, Err: errors.New("build failed: exit status 1")},
+		},
+	}
+
+	buff := &bytes.Buffer{}
+	err := writeJSON(buff, res)
+	Equal(t, err, nil)
+
+	var report jsonReport
+	err = json.Unmarshal(buff.Bytes(), &report)
+	Equal(t, err, nil)
+	Equal(t, report.Output, "/tmp/overalls.coverprofile")
+	Equal(t, report.Coverage, float64(50))
+	Equal(t, len(report.Packages), 3)
+	Equal(t, report.Packages[0], jsonPackage{Package: "example.com/a", Coverage: 100, Passed: true, Attempts: 1, Duration: 1.5})
+	Equal(t, report.Packages[1], jsonPackage{Package: "example.com/b", Error: "exit status 1", Attempts: 2, ExitCode: 1, Duration: 1})
+	Equal(t, report.Packages[2], jsonPackage{Package: "example.com/c", BuildFailed: true, Error: "build failed: exit status 1", Attempts: 1, ExitCode: 1})
+
+	buff.Reset()
+	err = writeJSON(buff, overalls.Result{})
+	Equal(t, err, nil)
+	MatchRegex(t, buff.String(), `"packages": \[\]`)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// splitTestFlags splits the -testflags string s into arguments as a shell
+// would, without any expansion: arguments are separated by whitespace,
+// single quotes keep everything up to the next one as is, double quotes
+// keep everything but a backslash escaping '"' or '\', and a backslash
+// outside quotes escapes the next character.
+//
+//	-run='Test A|Test B' -v "-ldflags=-X main.v=1"
+//
+// is the three arguments -run=Test A|Test B, -v and -ldflags=-X main.v=1.
+func splitTestFlags(s string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool
+		quote rune
+	)
+
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+				i++
+				arg.WriteRune(runes[i])
+			default:
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("invalid testflags '%s', trailing backslash", s)
+			}
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("invalid testflags '%s', unterminated %c quote", s, quote)
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
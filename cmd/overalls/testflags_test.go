@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestSplitTestFlags(t *testing.T) {
+	tests := []struct {
+		in   string
+		args []string
+	}{
+		{in: ""},
+		{in: "  \t "},
+		{in: "-run=Integration -failfast", args: []string{"-run=Integration", "-failfast"}},
+		{in: "  -v\t-short\n", args: []string{"-v", "-short"}},
+		{in: `-run='Test A|Test B' -v`, args: []string{"-run=Test A|Test B", "-v"}},
+		{in: `"-ldflags=-X main.v=1 -s"`, args: []string{"-ldflags=-X main.v=1 -s"}},
+		{in: `-run="say \"hi\"" -x`, args: []string{`-run=say "hi"`, "-x"}},
+		{in: `"a\b" 'c\d'`, args: []string{`a\b`, `c\d`}},
+		{in: `-run=with\ space`, args: []string{"-run=with space"}},
+		{in: `'' ""`, args: []string{"", ""}},
+		{in: `-run='it'"'"'s'`, args: []string{"-run=it's"}},
+	}
+
+	for _, tt := range tests {
+		args, err := splitTestFlags(tt.in)
+		Equal(t, err, nil)
+		Equal(t, args, tt.args)
+	}
+
+	_, err := splitTestFlags(`-run='open`)
+	Equal(t, err.Error(), `invalid testflags '-run='open', unterminated ' quote`)
+
+	_, err = splitTestFlags(`-run="open`)
+	Equal(t, err.Error(), `invalid testflags '-run="open', unterminated " quote`)
+
+	_, err = splitTestFlags(`-v \`)
+	Equal(t, err.Error(), `invalid testflags '-v \', trailing backslash`)
+}
+
+func TestParseFlags_TestFlags(t *testing.T) {
+	_, opts, err := parseFlags([]string{testFiles, `-testflags=-run='Test A' -failfast`, "--", "-v"}, ioutil.Discard)
+	Equal(t, err, nil)
+	Equal(t, opts.TestArgs, []string{"-run=Test A", "-failfast", "-v"})
+
+	_, opts, err = parseFlags([]string{testFiles, "-testflags=-run TestA", "--", "-count", "1", "-args", "-x"}, ioutil.Discard)
+	Equal(t, err, nil)
+	Equal(t, opts.TestArgs, []string{"-run", "TestA", "-count", "1", "-args", "-x"})
+
+	_, _, err = parseFlags([]string{testFiles, `-testflags="-run`}, ioutil.Discard)
+	Equal(t, err.Error(), `invalid testflags '"-run', unterminated " quote`)
+}
@@ -0,0 +1,307 @@
+package overalls
+
+import (
+	"encoding/xml"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// coberturaDTD is the doctype of the Cobertura XML reports.
+const coberturaDTD = `<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">`
+
+// coberturaCoverage and the types below it are the elements of a Cobertura
+// XML report, only line coverage is reported.
+type coberturaCoverage struct {
+	XMLName      xml.Name           `xml:"coverage"`
+	LineRate     float64            `xml:"line-rate,attr"`
+	BranchRate   float64            `xml:"branch-rate,attr"`
+	LinesCovered int                `xml:"lines-covered,attr"`
+	LinesValid   int                `xml:"lines-valid,attr"`
+	Timestamp    int64              `xml:"timestamp,attr"`
+	Version      string             `xml:"version,attr"`
+	Sources      []string           `xml:"sources>source"`
+	Packages     []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Complexity float64          `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   float64         `xml:"line-rate,attr"`
+	BranchRate float64         `xml:"branch-rate,attr"`
+	Complexity float64         `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// sourceFile maps the import path file name of a block to the directory it
+// is found in and its name relative to that directory.
+type sourceFile func(file string) (source, name string)
+
+// lineHits returns the hits of each line of each file of blocks, keyed by the
+// file's import path. A line is given the highest count of the blocks
+// spanning it.
+func lineHits(blocks []block) map[string]map[int]int {
+	files := map[string]map[int]int{}
+
+	for _, b := range blocks {
+		start, end, ok := b.lines()
+		if !ok {
+			continue
+		}
+
+		lines, found := files[b.file()]
+		if !found {
+			lines = map[int]int{}
+			files[b.file()] = lines
+		}
+
+		for line := start; line <= end; line++ {
+			if hits, found := lines[line]; !found || b.count > hits {
+				lines[line] = b.count
+			}
+		}
+	}
+
+	return files
+}
+
+// statementHits returns, as lineHits, the hits of the lines of each file of
+// blocks, but only of the lines a statement starts on, reading the files
+// with source, so braces, blank lines and comments within a block are not
+// reported as code. A line is given the highest count of the blocks holding
+// a statement starting on it. The lines of a file that can't be read or
+// parsed are those of lineHits.
+func statementHits(blocks []block, source sourceFile) map[string]map[int]int {
+	var names []string
+	byFile := map[string][]block{}
+
+	for _, b := range blocks {
+		name := b.file()
+		if _, found := byFile[name]; !found {
+			names = append(names, name)
+		}
+		byFile[name] = append(byFile[name], b)
+	}
+
+	files := map[string]map[int]int{}
+
+	for _, name := range names {
+		src, rel := source(name)
+
+		stmts, err := statements(filepath.Join(src, filepath.FromSlash(rel)))
+		if err != nil {
+			if lines, found := lineHits(byFile[name])[name]; found {
+				files[name] = lines
+			}
+			continue
+		}
+
+		lines := map[int]int{}
+
+		for _, b := range byFile[name] {
+			start, end, ok := b.span()
+			if !ok {
+				continue
+			}
+
+			// the statements from the start of the block up to its end
+			i := sort.Search(len(stmts), func(i int) bool { return !stmts[i].before(start) })
+			for ; i < len(stmts) && stmts[i].before(end); i++ {
+				if hits, found := lines[stmts[i].line]; !found || b.count > hits {
+					lines[stmts[i].line] = b.count
+				}
+			}
+		}
+
+		if len(lines) > 0 {
+			files[name] = lines
+		}
+	}
+
+	return files
+}
+
+// position is a line and column of a source file, both starting at 1 and
+// the column counted in bytes, as in the position ranges of blocks.
+type position struct {
+	line, col int
+}
+
+// before reports whether p comes before q.
+func (p position) before(q position) bool {
+	return p.line < q.line || (p.line == q.line && p.col < q.col)
+}
+
+// statements returns where each statement of the Go file at path starts, in
+// order. An if, for or switch counts as a statement of its own, like the
+// statements of its body, its case clauses and its braces don't.
+func statements(path string) ([]position, error) {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmts []position
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n.(type) {
+		case nil, *ast.BlockStmt, *ast.CaseClause, *ast.CommClause, *ast.LabeledStmt, *ast.EmptyStmt:
+		case ast.Stmt:
+			p := fset.Position(n.Pos())
+			stmts = append(stmts, position{line: p.Line, col: p.Column})
+		}
+		return true
+	})
+
+	sort.Slice(stmts, func(i, j int) bool { return stmts[i].before(stmts[j]) })
+
+	return stmts, nil
+}
+
+// writeCobertura writes blocks to w as a Cobertura XML report. Each line a
+// statement starts on is reported with the highest count of the blocks
+// holding it, each file as a class of the package of its directory.
+func writeCobertura(w io.Writer, blocks []block, source sourceFile) error {
+	files := statementHits(blocks, source)
+	sources := map[string]bool{}
+
+	report := coberturaCoverage{Timestamp: time.Now().UnixNano() / int64(time.Millisecond), Version: "overalls"}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if di, dj := path.Dir(names[i]), path.Dir(names[j]); di != dj {
+			return di < dj
+		}
+		return names[i] < names[j]
+	})
+
+	var pkgCovered, pkgValid int
+
+	for _, name := range names {
+		src, filename := source(name)
+		sources[src] = true
+
+		pkg := path.Dir(name)
+
+		if n := len(report.Packages); n == 0 || report.Packages[n-1].Name != pkg {
+			pkgCovered, pkgValid = 0, 0
+			report.Packages = append(report.Packages, coberturaPackage{Name: pkg})
+		}
+
+		class := coberturaClass{Name: path.Base(name), Filename: filename}
+		for line, hits := range files[name] {
+			class.Lines = append(class.Lines, coberturaLine{Number: line, Hits: hits})
+		}
+		sort.Slice(class.Lines, func(i, j int) bool { return class.Lines[i].Number < class.Lines[j].Number })
+
+		covered := 0
+		for _, l := range class.Lines {
+			if l.Hits > 0 {
+				covered++
+			}
+		}
+		class.LineRate = rate(covered, len(class.Lines))
+
+		pkgCovered += covered
+		pkgValid += len(class.Lines)
+		report.LinesCovered += covered
+		report.LinesValid += len(class.Lines)
+
+		p := &report.Packages[len(report.Packages)-1]
+		p.Classes = append(p.Classes, class)
+		p.LineRate = rate(pkgCovered, pkgValid)
+	}
+
+	for src := range sources {
+		report.Sources = append(report.Sources, src)
+	}
+	sort.Strings(report.Sources)
+
+	report.LineRate = rate(report.LinesCovered, report.LinesValid)
+
+	if _, err := io.WriteString(w, xml.Header+coberturaDTD+"\n"); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// rate returns covered as a fraction of total, or 0 when total is.
+func rate(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(covered) / float64(total)
+}
+
+// lines returns the first and last line of the block's position range,
+// reporting false when it can't be parsed.
+func (b block) lines() (start, end int, ok bool) {
+	from, to, ok := b.span()
+
+	return from.line, to.line, ok
+}
+
+// span returns the position range of the block's key, the end being just
+// past the block, reporting false when the key holds none.
+func (b block) span() (start, end position, ok bool) {
+	i := strings.LastIndex(b.key, ":")
+	if i < 0 {
+		return position{}, position{}, false
+	}
+
+	// startLine.startCol,endLine.endCol
+	parts := strings.FieldsFunc(b.key[i+1:], func(c rune) bool { return c == '.' || c == ',' })
+	if len(parts) != 4 {
+		return position{}, position{}, false
+	}
+
+	var n [4]int
+	for i, part := range parts {
+		var err error
+		if n[i], err = strconv.Atoi(part); err != nil {
+			return position{}, position{}, false
+		}
+	}
+
+	start, end = position{line: n[0], col: n[1]}, position{line: n[2], col: n[3]}
+	if end.line < start.line {
+		return position{}, position{}, false
+	}
+
+	return start, end, true
+}
@@ -0,0 +1,88 @@
+package overalls
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestWriteCobertura(t *testing.T) {
+	blocks := parseBlocks("github.com/a/b/b.go:3.20,5.2 2 1\n" +
+		"github.com/a/b/b.go:5.2,7.3 1 0\n" +
+		"github.com/a/b/b.go:9.20,9.40 1 0\n" +
+		"github.com/a/b/c/c.go:3.20,4.2 1 4\n" +
+		"github.com/a/b/a.go:1.1,1.10 1 0\n" +
+		"example.com/m/m.go:3.20,3.30 1 1\n")
+
+	buff := &bytes.Buffer{}
+	err := writeCobertura(buff, blocks, func(file string) (string, string) {
+		if strings.HasPrefix(file, "example.com/m/") {
+			return "/src/m", strings.TrimPrefix(file, "example.com/m/")
+		}
+		return "/gopath/src", file
+	})
+	Equal(t, err, nil)
+	MatchRegex(t, buff.String(), `^<\?xml version="1.0" encoding="UTF-8"\?>\n<!DOCTYPE coverage `)
+
+	var report coberturaCoverage
+	err = xml.Unmarshal(buff.Bytes(), &report)
+	Equal(t, err, nil)
+
+	Equal(t, report.Sources, []string{"/gopath/src", "/src/m"})
+	Equal(t, report.LinesValid, 10)
+	Equal(t, report.LinesCovered, 6)
+	Equal(t, len(report.Packages), 3)
+
+	Equal(t, report.Packages[0].Name, "example.com/m")
+	Equal(t, report.Packages[0].Classes[0].Filename, "m.go")
+
+	// a.go and b.go stay in the same package though b/c sorts between them
+	pkg := report.Packages[1]
+	Equal(t, pkg.Name, "github.com/a/b")
+	Equal(t, len(pkg.Classes), 2)
+	Equal(t, pkg.Classes[0].Name, "a.go")
+	Equal(t, pkg.Classes[1].Filename, "github.com/a/b/b.go")
+
+	// line 5 is spanned by a covered and an uncovered block
+	Equal(t, pkg.Classes[1].Lines, []coberturaLine{
+		{Number: 3, Hits: 1}, {Number: 4, Hits: 1}, {Number: 5, Hits: 1},
+		{Number: 6, Hits: 0}, {Number: 7, Hits: 0}, {Number: 9, Hits: 0},
+	})
+	Equal(t, pkg.Classes[1].LineRate, 0.5)
+	Equal(t, pkg.LineRate, 3.0/7.0)
+
+	Equal(t, report.Packages[2].Name, "github.com/a/b/c")
+	Equal(t, report.Packages[2].Classes[0].Lines, []coberturaLine{{Number: 3, Hits: 4}, {Number: 4, Hits: 4}})
+}
+
+func TestOveralls_WithCobertura(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	// missing directories are created
+	cobertura := filepath.Join(dir, "reports", "coverage.xml")
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		b, err := ioutil.ReadFile(cobertura)
+		Equal(t, err, nil)
+
+		var report coberturaCoverage
+		err = xml.Unmarshal(b, &report)
+		Equal(t, err, nil)
+		Equal(t, report.Sources, []string{srcPath[:len(srcPath)-1]})
+		Equal(t, report.Packages[0].Name, "github.com/go-playground/overalls/test-files/good")
+		Equal(t, report.Packages[0].Classes[0].Filename, "github.com/go-playground/overalls/test-files/good/main.go")
+		// the return statement, not the closing brace after it
+		Equal(t, report.Packages[0].Classes[0].Lines, []coberturaLine{{Number: 4, Hits: 1}})
+		Equal(t, report.LineRate, float64(1))
+	}, func(opts *Options) { opts.Cobertura = cobertura })
+}
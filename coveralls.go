@@ -0,0 +1,204 @@
+package overalls
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// coverallsURL is the Coveralls API endpoint jobs are posted to.
+var coverallsURL = "https://coveralls.io/api/v1/jobs"
+
+// coverallsJob and the types below it are the JSON job posted to the
+// Coveralls API.
+type coverallsJob struct {
+	RepoToken   string                `json:"repo_token"`
+	ServiceName string                `json:"service_name"`
+	RunAt       string                `json:"run_at"`
+	Git         *coverallsGit         `json:"git,omitempty"`
+	SourceFiles []coverallsSourceFile `json:"source_files"`
+}
+
+type coverallsGit struct {
+	Head   coverallsHead `json:"head"`
+	Branch string        `json:"branch"`
+}
+
+type coverallsHead struct {
+	ID             string `json:"id"`
+	AuthorName     string `json:"author_name"`
+	AuthorEmail    string `json:"author_email"`
+	CommitterName  string `json:"committer_name"`
+	CommitterEmail string `json:"committer_email"`
+	Message        string `json:"message"`
+}
+
+type coverallsSourceFile struct {
+	Name         string `json:"name"`
+	SourceDigest string `json:"source_digest"`
+
+	// Coverage has the hits of each line of the file, null for lines that
+	// are not code.
+	Coverage []*int `json:"coverage"`
+}
+
+// coverallsSourceFiles returns the Coveralls source files of blocks, named
+// relative to the directory root as Coveralls expects them to be relative to
+// the repository. Files outside root keep their import path.
+func coverallsSourceFiles(blocks []block, source sourceFile, root string) ([]coverallsSourceFile, error) {
+	files := statementHits(blocks, source)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sourceFiles []coverallsSourceFile
+
+	for _, name := range names {
+		src, rel := source(name)
+		path := filepath.Join(src, filepath.FromSlash(rel))
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		sf := coverallsSourceFile{Name: name, SourceDigest: sourceDigest(b)}
+
+		if real, err := filepath.EvalSymlinks(path); err == nil && len(root) > 0 {
+			if rel, err := filepath.Rel(root, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+separator) {
+				sf.Name = filepath.ToSlash(rel)
+			}
+		}
+
+		n := bytes.Count(b, []byte("\n"))
+		if len(b) > 0 && b[len(b)-1] != '\n' {
+			n++
+		}
+
+		sf.Coverage = make([]*int, n)
+		for line, hits := range files[name] {
+			if line >= 1 && line <= n {
+				hits := hits
+				sf.Coverage[line-1] = &hits
+			}
+		}
+
+		sourceFiles = append(sourceFiles, sf)
+	}
+
+	return sourceFiles, nil
+}
+
+// gitRoot returns the top level directory of the git repository containing
+// dir, with symlinks resolved, or an empty string when it isn't in one.
+func gitRoot(dir string) string {
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	cmd.Dir = dir
+
+	b, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	root, err := filepath.EvalSymlinks(strings.TrimSpace(string(b)))
+	if err != nil {
+		return ""
+	}
+
+	return root
+}
+
+// gitHead returns the commit checked out, and its branch, in the git
+// repository containing dir or nil when it isn't in one.
+func gitHead(dir string) *coverallsGit {
+	cmd := exec.Command("git", "log", "-1", "--format=%H%n%an%n%ae%n%cn%n%ce%n%s")
+	cmd.Dir = dir
+
+	b, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	fields := strings.SplitN(strings.TrimRight(string(b), "\n"), "\n", 6)
+	if len(fields) != 6 {
+		return nil
+	}
+
+	git := &coverallsGit{Head: coverallsHead{
+		ID:             fields[0],
+		AuthorName:     fields[1],
+		AuthorEmail:    fields[2],
+		CommitterName:  fields[3],
+		CommitterEmail: fields[4],
+		Message:        fields[5],
+	}}
+
+	cmd = exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd.Dir = dir
+
+	if b, err = cmd.Output(); err == nil {
+		git.Branch = strings.TrimSpace(string(b))
+	}
+
+	return git
+}
+
+// postCoveralls posts job to the Coveralls API as the json_file of a
+// multipart form, as its documentation asks.
+func postCoveralls(job coverallsJob) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+
+	part, err := w.CreateFormFile("json_file", "coverage.json")
+	if err != nil {
+		return err
+	}
+
+	if _, err = part.Write(b); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+
+	resp, err := client.Post(coverallsURL, w.FormDataContentType(), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s\n%s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// sourceDigest returns the md5 hex digest Coveralls uses to detect changed
+// sources.
+func sourceDigest(b []byte) string {
+	sum := md5.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
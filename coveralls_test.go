@@ -0,0 +1,108 @@
+package overalls
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestCoverallsSourceFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	err = os.MkdirAll(filepath.Join(dir, "a"), 0755)
+	Equal(t, err, nil)
+	err = ioutil.WriteFile(filepath.Join(dir, "a", "a.go"), []byte("package a\n\nfunc A() {\n\treturn\n}\n\nfunc B() {}"), 0644)
+	Equal(t, err, nil)
+
+	root, err := filepath.EvalSymlinks(dir)
+	Equal(t, err, nil)
+
+	blocks := parseBlocks(`mode: count
+example.com/a/a.go:3.10,5.2 1 2
+example.com/a/a.go:7.11,7.13 0 0
+example.com/a/a.go:4.2,4.8 1 3
+`)
+
+	source := func(file string) (string, string) { return dir, file[len("example.com/"):] }
+
+	files, err := coverallsSourceFiles(blocks, source, root)
+	Equal(t, err, nil)
+	Equal(t, len(files), 1)
+	Equal(t, files[0].Name, "a/a.go")
+	Equal(t, files[0].SourceDigest, "77bda81ed2ae2daeb8c83cb169320351")
+	Equal(t, len(files[0].Coverage), 7)
+
+	hits := func(line int) interface{} {
+		if h := files[0].Coverage[line-1]; h != nil {
+			return *h
+		}
+		return nil
+	}
+	// only the lines statements start on, not the braces of their blocks
+	Equal(t, hits(1), nil)
+	Equal(t, hits(3), nil)
+	Equal(t, hits(4), 3)
+	Equal(t, hits(5), nil)
+	Equal(t, hits(6), nil)
+	Equal(t, hits(7), nil)
+
+	// outside the repository the import path is kept
+	files, err = coverallsSourceFiles(blocks, source, filepath.Join(root, "other"))
+	Equal(t, err, nil)
+	Equal(t, files[0].Name, "example.com/a/a.go")
+
+	_, err = coverallsSourceFiles(parseBlocks("example.com/missing.go:1.1,2.2 1 1\n"), source, root)
+	NotEqual(t, err, nil)
+}
+
+func TestOveralls_WithCoveralls(t *testing.T) {
+	defer cleanFixtures()
+
+	var job coverallsJob
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("json_file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+
+		if err := json.NewDecoder(f).Decode(&job); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if job.RepoToken != "token" {
+			http.Error(w, "Couldn't find a repository matching this job.", http.StatusUnprocessableEntity)
+		}
+	}))
+	defer server.Close()
+
+	defer func(url string) { coverallsURL = url }(coverallsURL)
+	coverallsURL = server.URL
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		Equal(t, job.ServiceName, "overalls")
+		NotEqual(t, job.Git, nil)
+		Equal(t, len(job.Git.Head.ID), 40)
+
+		names := map[string]bool{}
+		for _, f := range job.SourceFiles {
+			names[f.Name] = true
+		}
+		Equal(t, names["test-files/good/main.go"], true)
+		Equal(t, names["test-files/good2/main.go"], true)
+	}, func(opts *Options) { opts.CoverallsToken = "token" })
+
+	_, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", CoverallsToken: "wrong"})
+	Equal(t, err.Error(), "error posting to Coveralls\n422 Unprocessable Entity\nCouldn't find a repository matching this job.")
+}
@@ -0,0 +1,119 @@
+package overalls
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// Delta compares the merged coverage of a Run with Options.Baseline.
+type Delta struct {
+	// Baseline is the percentage of statements covered by the baseline.
+	Baseline float64
+
+	// Change is the merged coverage minus Baseline, in percentage points.
+	Change float64
+
+	// Packages holds the change of each package directory found in either
+	// profile, sorted by package. A package missing from one is 0 there.
+	Packages []PackageDelta
+
+	// Uncovered are the lines a statement starts on not covered by the
+	// merged profile that were covered by the baseline or not in it at all,
+	// sorted by file and line. Lines are matched by number, so code moved
+	// since the baseline shows up as newly uncovered too.
+	Uncovered []Line
+}
+
+// PackageDelta is the change in coverage of a single package directory.
+type PackageDelta struct {
+	// Package is the import path of the directory.
+	Package string
+
+	// Baseline and Coverage are the percentages of statements covered by
+	// the baseline and merged profiles.
+	Baseline float64
+	Coverage float64
+
+	// Change is Coverage minus Baseline, in percentage points.
+	Change float64
+}
+
+// Line is a single line of a file, named by its import path as in a
+// coverprofile.
+type Line struct {
+	File string
+	Line int
+}
+
+// newDelta compares the coverage of blocks with that of the baseline's,
+// reading the files with source for the lines statements start on.
+func newDelta(blocks, baseline []block, source sourceFile) *Delta {
+	current := percentCovered(blocks)
+	d := &Delta{Baseline: percentCovered(baseline)}
+	d.Change = current - d.Baseline
+
+	packages := map[string]*PackageDelta{}
+	get := func(pkg string) *PackageDelta {
+		p, found := packages[pkg]
+		if !found {
+			p = &PackageDelta{Package: pkg}
+			packages[pkg] = p
+		}
+		return p
+	}
+
+	for _, p := range packageCoverage(baseline) {
+		get(p.Package).Baseline = p.Coverage
+	}
+
+	for _, p := range packageCoverage(blocks) {
+		get(p.Package).Coverage = p.Coverage
+	}
+
+	for _, p := range packages {
+		p.Change = p.Coverage - p.Baseline
+		d.Packages = append(d.Packages, *p)
+	}
+	sort.Slice(d.Packages, func(i, j int) bool { return d.Packages[i].Package < d.Packages[j].Package })
+
+	before := statementHits(baseline, source)
+
+	for file, lines := range statementHits(blocks, source) {
+		for line, hits := range lines {
+			if hits > 0 {
+				continue
+			}
+
+			// uncovered in the baseline too isn't new
+			if h, found := before[file][line]; found && h == 0 {
+				continue
+			}
+
+			d.Uncovered = append(d.Uncovered, Line{File: file, Line: line})
+		}
+	}
+	sort.Slice(d.Uncovered, func(i, j int) bool {
+		if d.Uncovered[i].File != d.Uncovered[j].File {
+			return d.Uncovered[i].File < d.Uncovered[j].File
+		}
+		return d.Uncovered[i].Line < d.Uncovered[j].Line
+	})
+
+	return d
+}
+
+// readBaseline reads the blocks of the baseline coverprofile, leaving out
+// those of Options.ExcludeFiles as for the merged profile.
+func (r *runner) readBaseline() ([]block, error) {
+	b, err := ioutil.ReadFile(r.baselinePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading baseline '%s'\n%s", r.baselinePath, err)
+	}
+
+	if !modeRegex.Match(b) {
+		return nil, fmt.Errorf("invalid baseline profile '%s', missing mode line", r.baselinePath)
+	}
+
+	return excludeBlocks(parseBlocks(string(b)), r.excludes), nil
+}
@@ -0,0 +1,119 @@
+package overalls
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestNewDelta(t *testing.T) {
+	baseline := parseBlocks("github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b.go:7.20,9.2 1 0\n" +
+		"github.com/a/c/c.go:3.20,4.2 1 1\n")
+
+	current := parseBlocks("github.com/a/b/b.go:3.20,5.2 1 0\n" +
+		"github.com/a/b/b.go:7.20,9.2 1 0\n" +
+		"github.com/a/d/d.go:1.1,1.10 1 1\n" +
+		"github.com/a/d/d.go:3.1,3.10 1 0\n")
+
+	// the files can't be read, so every line of a block counts
+	missing := func(file string) (string, string) { return "", file }
+
+	d := newDelta(current, baseline, missing)
+	Equal(t, d.Baseline, percentCovered(baseline))
+	Equal(t, d.Change, float64(25)-percentCovered(baseline))
+
+	Equal(t, d.Packages, []PackageDelta{
+		{Package: "github.com/a/b", Baseline: 50, Coverage: 0, Change: -50},
+		{Package: "github.com/a/c", Baseline: 100, Coverage: 0, Change: -100},
+		{Package: "github.com/a/d", Baseline: 0, Coverage: 50, Change: 50},
+	})
+
+	// b.go lines 7-9 were already uncovered
+	Equal(t, d.Uncovered, []Line{
+		{File: "github.com/a/b/b.go", Line: 3},
+		{File: "github.com/a/b/b.go", Line: 4},
+		{File: "github.com/a/b/b.go", Line: 5},
+		{File: "github.com/a/d/d.go", Line: 3},
+	})
+
+	d = newDelta(baseline, baseline, missing)
+	Equal(t, d.Change, float64(0))
+	Equal(t, len(d.Uncovered), 0)
+
+	// read, only the lines statements start on are newly uncovered
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n\nfunc A() {\n\t// comment\n\tprintln()\n}\n"), 0644)
+	Equal(t, err, nil)
+
+	source := func(file string) (string, string) { return dir, filepath.Base(file) }
+
+	d = newDelta(parseBlocks("github.com/a/a.go:3.10,6.2 1 0\n"), parseBlocks("github.com/a/a.go:3.10,6.2 1 1\n"), source)
+	Equal(t, d.Uncovered, []Line{{File: "github.com/a/a.go", Line: 5}})
+}
+
+func TestOveralls_WithBaseline(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	baseline := filepath.Join(dir, "baseline.coverprofile")
+	err = ioutil.WriteFile(baseline, []byte(`mode: set
+github.com/go-playground/overalls/test-files/good/main.go:4.2,5.1 1 1
+example.com/other/other.go:3.14,5.2 1 1
+`), 0644)
+	Equal(t, err, nil)
+
+	merge := filepath.Join(dir, "merge.coverprofile")
+	err = ioutil.WriteFile(merge, []byte("mode: count\nexample.com/other/other.go:3.14,5.2 1 0\n"), 0644)
+	Equal(t, err, nil)
+
+	opts := Options{
+		Project:  "github.com/go-playground/overalls/test-files",
+		Includes: []string{"good"},
+		Baseline: baseline,
+	}
+
+	res, err := Run(opts)
+	Equal(t, err, nil)
+	NotEqual(t, res.Delta, nil)
+	Equal(t, res.Delta.Baseline, float64(100))
+	Equal(t, res.Delta.Change, float64(0))
+	Equal(t, len(res.Delta.Uncovered), 0)
+
+	// the other package is no longer covered
+	opts.Merge = merge
+	opts.FailOnDecrease = true
+
+	res, err = Run(opts)
+	Equal(t, err, ErrCoverageDecreased)
+	Equal(t, res.Coverage, float64(50))
+	Equal(t, res.Delta.Change, float64(-50))
+	Equal(t, res.Delta.Packages[0], PackageDelta{Package: "example.com/other", Baseline: 100, Coverage: 0, Change: -100})
+	Equal(t, res.Delta.Uncovered, []Line{{"example.com/other/other.go", 3}, {"example.com/other/other.go", 4}, {"example.com/other/other.go", 5}})
+
+	os.Remove(res.Output)
+
+	// generated files are left out of the baseline as well
+	opts.ExcludeFiles = []string{"other*.go"}
+
+	res, err = Run(opts)
+	Equal(t, err, nil)
+	Equal(t, res.Delta.Change, float64(0))
+
+	os.Remove(res.Output)
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", FailOnDecrease: true})
+	Equal(t, err.Error(), "invalid fail-on-decrease, requires a baseline")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Baseline: filepath.Join(dir, "missing")})
+	MatchRegex(t, err.Error(), "^error reading baseline '"+filepath.Join(dir, "missing")+"'\n")
+}
@@ -3,34 +3,20 @@ Package overalls takes multi-package go projects, runs test coverage tests on
 all packages in each directory and finally concatenates into a single file for
 tools like goveralls.
 
-	$ overalls -help
-
-	usage: overalls -project=[path] -covermode[mode] OPTIONS
-
-	overalls recursively traverses your projects directory structure
-	running 'go test -covermode=count -coverprofile=profile.coverprofile'
-	in each directory with go test files, concatenates them into one
-	coverprofile in your root directory named 'overalls.coverprofile'
-
-	OPTIONS
-	  -project
-		Your project path relative to the '$GOPATH/src' directory
-		example: -project=github.com/bluesuncorp/overalls
-
-	  -covermode
-	    Mode to run when testing files.
-	    default:count
-
-	OPTIONAL
-
-	  -ignore
-	    A comma separated list of directory names to ignore, relative to project path.
-	    example: -ignore=[.git,.hiddentdir...]
-	    default: '.git'
-
-	  -debug
-	    A flag indicating whether to print debug messages.
-	    example: -debug
-	    default:false
+This package is the library behind the overalls command, found in
+github.com/go-playground/overalls/cmd/overalls, and lets the same coverage
+aggregation be embedded in other tooling without shelling out.
+
+	res, err := overalls.Run(overalls.Options{
+		Project:   "github.com/bluesuncorp/overalls",
+		CoverMode: "count",
+	})
+	if err != nil {
+		// ErrPackagesFailed still writes the coverage that was collected
+	}
+
+	for _, pkg := range res.Packages {
+		fmt.Printf("%s %.1f%%\n", pkg.ImportPath, pkg.Coverage)
+	}
 */
-package main
+package overalls
@@ -0,0 +1,66 @@
+package overalls
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// TestCounts are the tests of a package that passed, failed and were
+// skipped, subtests included, as reported by go test -json.
+type TestCounts struct {
+	Passed  int
+	Failed  int
+	Skipped int
+}
+
+// testEvent is the part of a go test -json event overalls uses.
+type testEvent struct {
+	Action string
+	Test   string
+	Output string
+}
+
+// testEvents counts the tests of the go test -json events it is given.
+type testEvents struct {
+	counts TestCounts
+}
+
+// add takes the line of go test -json output, returning the text go test
+// would have printed for it without -json, empty for none. Lines that are
+// not events, such as the output of a failed build, are returned as is.
+func (e *testEvents) add(line string) string {
+	var ev testEvent
+	if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &ev) != nil || len(ev.Action) == 0 {
+		return line
+	}
+
+	if len(ev.Test) > 0 {
+		switch ev.Action {
+		case "pass":
+			e.counts.Passed++
+		case "fail":
+			e.counts.Failed++
+		case "skip":
+			e.counts.Skipped++
+		}
+	}
+
+	if ev.Action != "output" && ev.Action != "build-output" {
+		return ""
+	}
+
+	return strings.TrimSuffix(ev.Output, "\n")
+}
+
+// decode returns the text of the go test -json output b, as add.
+func (e *testEvents) decode(b []byte) string {
+	var out strings.Builder
+
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if text := e.add(strings.TrimSuffix(line, "\n")); len(text) > 0 {
+			out.WriteString(text + "\n")
+		}
+	}
+
+	return out.String()
+}
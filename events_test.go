@@ -0,0 +1,67 @@
+package overalls
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestTestEvents(t *testing.T) {
+	var events testEvents
+
+	lines := []struct {
+		in, out string
+	}{
+		{in: `{"Action":"start","Package":"a"}`},
+		{in: `{"Action":"run","Package":"a","Test":"TestA"}`},
+		{in: `{"Action":"output","Package":"a","Test":"TestA","Output":"=== RUN   TestA\n"}`, out: "=== RUN   TestA"},
+		{in: `{"Action":"pass","Package":"a","Test":"TestA"}`},
+		{in: `{"Action":"pass","Package":"a","Test":"TestA/sub"}`},
+		{in: `{"Action":"fail","Package":"a","Test":"TestB"}`},
+		{in: `{"Action":"skip","Package":"a","Test":"TestC"}`},
+		{in: `{"Action":"build-output","ImportPath":"a","Output":"a.go:1:1: bad\n"}`, out: "a.go:1:1: bad"},
+		{in: `{"Action":"fail","Package":"a"}`},
+		{in: "# a", out: "# a"},
+		{in: "{not json", out: "{not json"},
+	}
+
+	for _, l := range lines {
+		Equal(t, events.add(l.in), l.out)
+	}
+
+	Equal(t, events.counts, TestCounts{Passed: 2, Failed: 1, Skipped: 1})
+
+	events = testEvents{}
+	text := events.decode([]byte("{\"Action\":\"output\",\"Output\":\"ok  \\ta\\n\"}\n{\"Action\":\"pass\",\"Test\":\"TestA\"}\nFAIL\n"))
+	Equal(t, text, "ok  \ta\nFAIL\n")
+	Equal(t, events.counts, TestCounts{Passed: 1})
+}
+
+func TestOveralls_JSONEvents(t *testing.T) {
+	defer cleanFixtures()
+
+	for _, quiet := range []bool{false, true} {
+		out := &bytes.Buffer{}
+
+		res, err := Run(Options{
+			Project:    "github.com/go-playground/overalls/test-files",
+			Includes:   []string{"good", "skipped"},
+			Tags:       "skipped",
+			JSONEvents: true,
+			Quiet:      quiet,
+			Logger:     log.New(out, "", 0),
+		})
+		Equal(t, err, nil)
+		Equal(t, len(res.Packages), 2)
+		Equal(t, res.Packages[0].Tests, TestCounts{Passed: 1})
+		Equal(t, res.Packages[0].Coverage, float64(100))
+		Equal(t, res.Packages[1].Tests, TestCounts{Skipped: 1})
+		Equal(t, bytes.Contains(out.Bytes(), []byte(`"Action"`)), false)
+
+		if !quiet {
+			MatchRegex(t, out.String(), "ok  \tgithub.com/go-playground/overalls/test-files/good\t.*coverage: 100.0% of statements\n")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package overalls
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreFilename is the file read from each directory with UseGitignore.
+const gitignoreFilename = ".gitignore"
+
+// gitignoreRule is a single line of a .gitignore file.
+type gitignoreRule struct {
+	// base is the slash separated directory of the .gitignore, relative to
+	// the project path, empty for the project directory itself.
+	base string
+
+	// segments is the pattern split on '/', it is matched against the
+	// whole path below base when anchored and against the last element
+	// otherwise.
+	segments []string
+	anchored bool
+	negate   bool
+}
+
+// gitignore holds the rules of the .gitignore files read while walking a
+// project. It only matches directories, which is all the walker needs, and
+// like git the last matching rule wins.
+type gitignore []gitignoreRule
+
+// load adds the rules of the .gitignore in dir, whose path relative to the
+// project path is rel. A missing or unreadable file adds nothing.
+func (g *gitignore) load(dir, rel string) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, gitignoreFilename))
+	if err != nil {
+		return
+	}
+
+	base := filepath.ToSlash(rel)
+
+	bs := bufio.NewScanner(bytes.NewReader(b))
+	for bs.Scan() {
+		if rule, ok := parseGitignoreRule(base, bs.Text()); ok {
+			*g = append(*g, rule)
+		}
+	}
+}
+
+// parseGitignoreRule parses a single .gitignore line, reporting false for
+// blank lines and comments.
+func parseGitignoreRule(base, line string) (gitignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if len(line) == 0 || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false
+	}
+
+	rule := gitignoreRule{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+
+	line = strings.TrimPrefix(line, `\`)
+	line = strings.TrimSuffix(line, "/")
+
+	// a separator anywhere but the end anchors the pattern to base
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if len(line) == 0 {
+		return gitignoreRule{}, false
+	}
+
+	rule.segments = strings.Split(line, "/")
+
+	return rule, true
+}
+
+// match reports whether the directory rel, relative to the project path, is
+// ignored.
+func (g gitignore) match(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	ignored := false
+
+	for _, rule := range g {
+		if rule.match(rel) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// match reports whether the rule's pattern matches rel, ignoring negation.
+func (rule gitignoreRule) match(rel string) bool {
+	sub := rel
+	if len(rule.base) > 0 {
+		if !strings.HasPrefix(rel, rule.base+"/") {
+			return false
+		}
+		sub = strings.TrimPrefix(rel, rule.base+"/")
+	}
+
+	if !rule.anchored {
+		ok, _ := path.Match(rule.segments[0], path.Base(sub))
+		return ok
+	}
+
+	return matchSegments(rule.segments, strings.Split(sub, "/"))
+}
+
+// matchSegments reports whether the path elements names match the pattern
+// segments, where a '**' segment matches any number of elements.
+func matchSegments(segments, names []string) bool {
+	if len(segments) == 0 {
+		return len(names) == 0
+	}
+
+	if segments[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if matchSegments(segments[1:], names[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(names) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(segments[0], names[0]); !ok {
+		return false
+	}
+
+	return matchSegments(segments[1:], names[1:])
+}
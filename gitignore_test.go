@@ -0,0 +1,72 @@
+package overalls
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestGitignore_Match(t *testing.T) {
+	tests := []struct {
+		base  string
+		lines []string
+		rel   string
+		match bool
+	}{
+		{lines: []string{"build"}, rel: "build", match: true},
+		{lines: []string{"build/"}, rel: "a/b/build", match: true},
+		{lines: []string{"/build"}, rel: "build", match: true},
+		{lines: []string{"/build"}, rel: "a/build", match: false},
+		{lines: []string{"a/build"}, rel: "a/build", match: true},
+		{lines: []string{"a/build"}, rel: "x/a/build", match: false},
+		{lines: []string{"*_gen"}, rel: "pkg/api_gen", match: true},
+		{lines: []string{"**/gen"}, rel: "gen", match: true},
+		{lines: []string{"**/gen"}, rel: "a/b/gen", match: true},
+		{lines: []string{"a/**/gen"}, rel: "a/b/c/gen", match: true},
+		{lines: []string{"a/**/gen"}, rel: "b/gen", match: false},
+		{lines: []string{"gen*", "!generator"}, rel: "generator", match: false},
+		{lines: []string{"gen*", "!generator"}, rel: "generated", match: true},
+		{lines: []string{"# build", "", "  "}, rel: "# build", match: false},
+		{lines: []string{`\#build`}, rel: "#build", match: true},
+		{base: "sub", lines: []string{"/out"}, rel: "sub/out", match: true},
+		{base: "sub", lines: []string{"/out"}, rel: "out", match: false},
+		{base: "sub", lines: []string{"out"}, rel: "sub/x/out", match: true},
+	}
+
+	for _, tt := range tests {
+		var g gitignore
+		for _, line := range tt.lines {
+			if rule, ok := parseGitignoreRule(tt.base, line); ok {
+				g = append(g, rule)
+			}
+		}
+
+		Equal(t, g.match(tt.rel), tt.match)
+	}
+}
+
+func TestOveralls_UseGitignore(t *testing.T) {
+	defer cleanFixtures()
+
+	gitignore := srcPath + "github.com/go-playground/overalls/test-files/" + gitignoreFilename
+	err := ioutil.WriteFile(gitignore, []byte("# generated\ngood2/\n/module/sub\n"), 0644)
+	Equal(t, err, nil)
+	defer os.Remove(gitignore)
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		NotEqual(t, strings.Index(final, "test-files/good/main.go"), -1)
+		NotEqual(t, strings.Index(final, "test-files/good2/main.go"), -1)
+	})
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		NotEqual(t, strings.Index(final, "test-files/good/main.go"), -1)
+		Equal(t, strings.Index(final, "test-files/good2/main.go"), -1)
+		Equal(t, strings.Index(final, "test-files/module/sub/sub.go"), -1)
+		MatchRegex(t, string(output), "DIR good2 ignored by .gitignore, skipping\n")
+	}, func(opts *Options) { opts.UseGitignore = true })
+}
@@ -0,0 +1,116 @@
+package overalls
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks a pattern as a regular expression rather than a glob.
+const regexPrefix = "re:"
+
+// pattern matches directories relative to the project path, or the import
+// path of files for Options.ExcludeFiles. It is one of:
+//
+//	vendor            a plain name, matching only that exact relative path
+//	internal/...      a plain name followed by '/...', matching that path and
+//	                  every directory below it
+//	*_generated       a path.Match glob, matching the relative path or its
+//	                  last element, so it applies at any depth
+//	re:(^|/)testdata$ a regular expression, matching anywhere in the
+//	                  slash separated relative path
+//
+// A leading './' is ignored for all but regular expressions.
+type pattern struct {
+	raw  string
+	glob bool
+	tree bool
+	re   *regexp.Regexp
+}
+
+// newPattern parses p, returning an error for an invalid glob or regular
+// expression.
+func newPattern(p string) (pattern, error) {
+	if strings.HasPrefix(p, regexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(p, regexPrefix))
+		if err != nil {
+			return pattern{}, fmt.Errorf("invalid pattern '%s'\n%s", p, err)
+		}
+
+		return pattern{raw: p, re: re}, nil
+	}
+
+	p = strings.TrimPrefix(p, "./")
+
+	if p == "..." || strings.HasSuffix(p, "/...") {
+		return pattern{raw: strings.TrimSuffix(strings.TrimSuffix(p, "..."), "/"), tree: true}, nil
+	}
+
+	if !strings.ContainsAny(p, `*?[\`) {
+		return pattern{raw: p}, nil
+	}
+
+	if _, err := path.Match(p, ""); err != nil {
+		return pattern{}, fmt.Errorf("invalid pattern '%s'\n%s", p, err)
+	}
+
+	return pattern{raw: p, glob: true}, nil
+}
+
+// match reports whether the directory rel, relative to the project path,
+// matches the pattern.
+func (p pattern) match(rel string) bool {
+	rel = filepath.ToSlash(rel)
+
+	switch {
+	case p.re != nil:
+		return p.re.MatchString(rel)
+	case p.tree:
+		return p.raw == "" || rel == p.raw || strings.HasPrefix(rel, p.raw+"/")
+	case p.glob:
+		if ok, _ := path.Match(p.raw, rel); ok {
+			return true
+		}
+
+		ok, _ := path.Match(p.raw, path.Base(rel))
+		return ok
+	default:
+		return p.raw == rel
+	}
+}
+
+// patterns is a list of patterns matching when any one of them does.
+type patterns []pattern
+
+// newPatterns parses each of list with newPattern, skipping empty entries.
+func newPatterns(list []string) (patterns, error) {
+	var ps patterns
+
+	for _, p := range list {
+		if len(p) == 0 {
+			continue
+		}
+
+		parsed, err := newPattern(p)
+		if err != nil {
+			return nil, err
+		}
+
+		ps = append(ps, parsed)
+	}
+
+	return ps, nil
+}
+
+// match reports whether any of the patterns match rel.
+func (ps patterns) match(rel string) bool {
+	for _, p := range ps {
+		if p.match(rel) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,99 @@
+package overalls
+
+import (
+	"strings"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestPattern_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		match   bool
+	}{
+		{pattern: "vendor", rel: "vendor", match: true},
+		{pattern: "vendor", rel: "pkg/vendor", match: false},
+		{pattern: "vendor", rel: "vendored", match: false},
+		{pattern: "*_generated", rel: "api_generated", match: true},
+		{pattern: "*_generated", rel: "pkg/api_generated", match: true},
+		{pattern: "*_generated", rel: "pkg/api", match: false},
+		{pattern: "internal/*", rel: "internal/foo", match: true},
+		{pattern: "internal/*", rel: "internal/foo/bar", match: false},
+		{pattern: "re:(^|/)testdata$", rel: "testdata", match: true},
+		{pattern: "re:(^|/)testdata$", rel: "a/b/testdata", match: true},
+		{pattern: "re:(^|/)testdata$", rel: "a/testdata2", match: false},
+		{pattern: "./internal/...", rel: "internal", match: true},
+		{pattern: "internal/...", rel: "internal/foo/bar", match: true},
+		{pattern: "internal/...", rel: "internalfoo", match: false},
+		{pattern: "./...", rel: "a/b", match: true},
+		{pattern: "./good", rel: "good", match: true},
+	}
+
+	for _, tt := range tests {
+		p, err := newPattern(tt.pattern)
+		Equal(t, err, nil)
+		Equal(t, p.match(tt.rel), tt.match)
+	}
+}
+
+func TestPattern_Invalid(t *testing.T) {
+	_, err := newPattern("[")
+	NotEqual(t, err, nil)
+
+	_, err = newPattern("re:(")
+	NotEqual(t, err, nil)
+}
+
+func TestOveralls_IgnorePatterns(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		Equal(t, strings.Index(final, "test-files/good/main.go"), -1)
+		Equal(t, strings.Index(final, "test-files/good2/main.go"), -1)
+		NotEqual(t, strings.Index(final, "test-files/module/sub/sub.go"), -1)
+	}, func(opts *Options) { opts.Ignores = []string{"good*", "re:^no-"} })
+}
+
+func TestOveralls_IncludePatterns(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		Equal(t, strings.Index(final, "test-files/good/main.go"), -1)
+		NotEqual(t, strings.Index(final, "test-files/good2/main.go"), -1)
+		NotEqual(t, strings.Index(final, "test-files/module/sub/sub.go"), -1)
+	}, func(opts *Options) { opts.Includes = []string{"good2", "./module/..."} })
+}
+
+func TestOveralls_ExcludeFiles(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		NotEqual(t, strings.Index(final, "test-files/good/main.go"), -1)
+		Equal(t, strings.Index(final, "test-files/good2/main.go"), -1)
+
+		// the package is still tested
+		MatchRegex(t, string(output), "Test package: github.com/go-playground/overalls/test-files/good2\n")
+	}, func(opts *Options) { opts.ExcludeFiles = []string{"re:/good2/"} })
+
+	_, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", ExcludeFiles: []string{"["}})
+	NotEqual(t, err, nil)
+	MatchRegex(t, err.Error(), "^invalid exclude-files: invalid pattern '\\['")
+}
+
+func TestOveralls_IncludeAndIgnore(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		NotEqual(t, strings.Index(final, "test-files/good/main.go"), -1)
+		Equal(t, strings.Index(final, "test-files/good2/main.go"), -1)
+	}, func(opts *Options) {
+		opts.Includes = []string{"good*"}
+		opts.Ignores = []string{"good2"}
+	})
+}
@@ -0,0 +1,50 @@
+package overalls
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// writeLcov writes blocks to w as an lcov tracefile, one record per file
+// named by its absolute path, as editors showing coverage in the gutter
+// open it. As for Cobertura each line a statement starts on is reported
+// with the highest count of the blocks holding it.
+func writeLcov(w io.Writer, blocks []block, source sourceFile) error {
+	files := statementHits(blocks, source)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+
+	for _, name := range names {
+		src, filename := source(name)
+
+		lines := make([]int, 0, len(files[name]))
+		for line := range files[name] {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", filepath.Join(src, filepath.FromSlash(filename)))
+
+		covered := 0
+		for _, line := range lines {
+			hits := files[name][line]
+			if hits > 0 {
+				covered++
+			}
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, hits)
+		}
+
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), covered)
+	}
+
+	return bw.Flush()
+}
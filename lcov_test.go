@@ -0,0 +1,81 @@
+package overalls
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestWriteLcov(t *testing.T) {
+	blocks := parseBlocks("github.com/a/b/b.go:3.20,5.2 2 1\n" +
+		"github.com/a/b/b.go:5.2,7.3 1 0\n" +
+		"github.com/a/b/a.go:1.1,1.10 1 0\n" +
+		"example.com/m/m.go:3.20,3.30 1 4\n")
+
+	buff := &bytes.Buffer{}
+	err := writeLcov(buff, blocks, func(file string) (string, string) {
+		if strings.HasPrefix(file, "example.com/m/") {
+			return "/src/m", strings.TrimPrefix(file, "example.com/m/")
+		}
+		return "/gopath/src", file
+	})
+	Equal(t, err, nil)
+
+	// the files can't be read, every line of a block is reported, line 5
+	// being spanned by a covered and an uncovered block
+	expected := "TN:\nSF:" + filepath.FromSlash("/src/m/m.go") + "\nDA:3,4\nLF:1\nLH:1\nend_of_record\n" +
+		"TN:\nSF:" + filepath.FromSlash("/gopath/src/github.com/a/b/a.go") + "\nDA:1,0\nLF:1\nLH:0\nend_of_record\n" +
+		"TN:\nSF:" + filepath.FromSlash("/gopath/src/github.com/a/b/b.go") + "\nDA:3,1\nDA:4,1\nDA:5,1\nDA:6,0\nDA:7,0\nLF:5\nLH:3\nend_of_record\n"
+	Equal(t, buff.String(), expected)
+
+	buff.Reset()
+	Equal(t, writeLcov(buff, nil, nil), nil)
+	Equal(t, buff.Len(), 0)
+}
+
+func TestWriteLcov_Statements(t *testing.T) {
+	// lcov.out is the profile go test wrote for the package in lcov.go,
+	// lcov.info the tracefile expected of it: the lines statements start
+	// on, not the braces, case clauses, comments and blank lines between
+	dir := filepath.Join("test-files", "testdata", "lcov")
+
+	profile, err := ioutil.ReadFile(filepath.Join(dir, "lcov.out"))
+	Equal(t, err, nil)
+
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "lcov.info"))
+	Equal(t, err, nil)
+
+	abs, err := filepath.Abs(dir)
+	Equal(t, err, nil)
+
+	buff := &bytes.Buffer{}
+	err = writeLcov(buff, parseBlocks(string(profile)), func(file string) (string, string) {
+		return abs, strings.TrimPrefix(file, "example.com/lcov/")
+	})
+	Equal(t, err, nil)
+	Equal(t, buff.String(), strings.Replace(string(expected), "SF:lcov.go", "SF:"+filepath.Join(abs, "lcov.go"), 1))
+}
+
+func TestOveralls_WithLcov(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	// missing directories are created
+	lcov := filepath.Join(dir, "reports", "coverage.info")
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		b, err := ioutil.ReadFile(lcov)
+		Equal(t, err, nil)
+
+		main := filepath.Join(srcPath, "github.com", "go-playground", "overalls", "test-files", "good", "main.go")
+		NotEqual(t, strings.Index(string(b), "TN:\nSF:"+main+"\nDA:4,1\nLF:1\nLH:1\nend_of_record\n"), -1)
+	}, func(opts *Options) { opts.Lcov = lcov })
+}
@@ -1,274 +1,2658 @@
-package main
+package overalls
 
 import (
 	"bufio"
 	"bytes"
-	"flag"
+	"context"
+	"errors"
 	"fmt"
+	"go/build"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	helpString = `
-usage: overalls -project=[path] -covermode[mode] OPTIONS
-
-overalls recursively traverses your projects directory structure
-running 'go test -covermode=count -coverprofile=profile.coverprofile'
-in each directory with go test files, concatenates them into one
-coverprofile in your root directory named 'overalls.coverprofile'
-
-OPTIONS
-  -project
-	Your project path relative to the '$GOPATH/src' directory
-	example: -project=github.com/bluesuncorp/overalls
-
-  -covermode
-    Mode to run when testing files.
-    default:count
-
-OPTIONAL
-
-  -ignore
-    A comma separated list of directory names to ignore, relative to project path.
-    example: -ignore=[.git,.hiddentdir...]
-    default: '.git,vendor'
-
-  -debug
-    A flag indicating whether to print debug messages.
-    example: -debug
-    default:false
-`
+	outFilename = "overalls.coverprofile"
+	pkgFilename = "profile.coverprofile"
+
+	// partialSuffix ends the name of the temporary file, beside the output,
+	// the coverage is streamed to while testing.
+	partialSuffix = ".partial"
+
+	// killGrace is how long past the timeout a package may run before its
+	// go test process is killed, giving go test a chance to time out itself.
+	killGrace = time.Minute
+
+	// drainGrace is how long running packages are waited on once the run is
+	// canceled before the collected coverage is written without them.
+	drainGrace = 5 * time.Second
+)
+
+var (
+	modeRegex   = regexp.MustCompile("mode: ([a-z]+)\n")
+	moduleRegex = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+	emptyStruct struct{}
+
+	// separator is the OS path separator, a variable for tests to simulate
+	// Windows paths on any OS.
+	separator = string(os.PathSeparator)
+
+	// buildFailedRegex matches the line go test prints for a package whose
+	// test binary could not be built, it exits 1 as for failing tests.
+	buildFailedRegex = regexp.MustCompile(`(?m)^FAIL\s+\S+\s+\[(build|setup) failed\]`)
+
+	// unresolvedRegex matches the lines go prints for an import path, the
+	// package argument or an import of its files, it could not resolve.
+	unresolvedRegex = regexp.MustCompile(`(?m)^.*(cannot find package|no required module provides package|use of internal package|malformed import path|is not in (GOROOT|std)).*$`)
+
+	// constraintsRegex matches the error go gives for a package none of
+	// whose files are included by the build constraints.
+	constraintsRegex = regexp.MustCompile(`build constraints exclude all Go files`)
+)
+
+// DefaultIgnores are the directory names ignored when Options.Ignores is nil.
+var DefaultIgnores = []string{".git"}
+
+// ErrPackagesFailed is returned by Run, along with a complete Result, when
+// the tests of one or more packages could not be run or did not pass.
+var ErrPackagesFailed = errors.New("overalls: one or more packages failed")
+
+// ErrCoverageTooLow is returned by Run, along with a complete Result, when
+// the total coverage is below Options.FailUnder.
+var ErrCoverageTooLow = errors.New("overalls: total coverage below threshold")
+
+// ErrPackageCoverageTooLow is returned by Run, along with a complete Result,
+// when the coverage of a package is below its minimum of
+// Options.PackageMinimums, each such package being in Result.BelowMinimum.
+var ErrPackageCoverageTooLow = errors.New("overalls: package coverage below threshold")
+
+// ErrCoverageDecreased is returned by Run, along with a complete Result,
+// when the total coverage is below that of Options.Baseline and
+// Options.FailOnDecrease is set.
+var ErrCoverageDecreased = errors.New("overalls: total coverage decreased")
+
+// ErrUntestedPackages is returned by Run, along with a complete Result, when
+// a package has no test files and Options.RequireTests is set.
+var ErrUntestedPackages = errors.New("overalls: packages without tests")
+
+// ErrPrebuildFailed is returned by Run when the go build or go vet of
+// Options.Prebuild fails, before any package is tested.
+var ErrPrebuildFailed = errors.New("overalls: prebuild failed")
+
+// ErrNoPackages is returned by Run, along with a complete Result, when no
+// package was tested and Options.AllowEmpty is not set.
+var ErrNoPackages = errors.New("overalls: no packages tested")
+
+// Options configures a single Run.
+type Options struct {
+	// Project is the project path relative to the '$GOPATH/src' directory.
+	// When a go.mod is found in the project or current directory it is
+	// treated as a filesystem path, or an import path within that module,
+	// instead. Otherwise an absolute path, or one starting with './' or
+	// '../', is used as the project directory directly.
+	Project string
+
+	// Projects are more project paths, in the same form as Project, tested
+	// in the same run with their coverage merged into the same Output.
+	Projects []string
+
+	// Root, when set, is the directory of Project to walk and run go test
+	// from, Project then only being the import path of that directory, for
+	// layouts where the two can't be derived from one another. In module
+	// mode its packages are part of the module whose go.mod is in Root, if
+	// any. It can't be used with Projects.
+	Root string
+
+	// CoverMode is the go test covermode, one of set, count or atomic.
+	// Defaults to count, or atomic when Race is set.
+	CoverMode string
+
+	// Race enables the race detector, which requires the atomic covermode.
+	// Any other CoverMode is upgraded to atomic with a warning, unless
+	// StrictCoverMode is set.
+	Race bool
+
+	// StrictCoverMode makes a CoverMode other than atomic along with Race an
+	// error rather than upgrading it.
+	StrictCoverMode bool
+
+	// Short is passed to each go test invocation as -short, skipping long
+	// tests that check testing.Short.
+	Short bool
+
+	// Verbose is passed to each go test invocation as -v, logging the
+	// output of every test. Unlike Debug it has no effect on overalls' own
+	// messages.
+	Verbose bool
+
+	// CPU is a comma separated list of GOMAXPROCS values passed to each go
+	// test invocation as -cpu. The tests run once per value, and per
+	// -count, all recorded in the same profile so count mode sums them.
+	CPU string
+
+	// Count is passed to each go test invocation as -count when above 0.
+	// A Count of 1 bypasses go's test cache, so every package is tested
+	// afresh rather than replaying a cached profile, at the cost of speed.
+	Count int
+
+	// Ignores is a list of directory names to ignore, relative to the
+	// project path. Entries may also be path.Match globs, matched against
+	// the relative path or its last element, or regular expressions
+	// prefixed with 're:'. Defaults to DefaultIgnores when nil. Directories
+	// go ignores, testdata and those starting with '.' or '_', are skipped
+	// too.
+	Ignores []string
+
+	// IncludeVendor also tests the packages in vendor directories, which are
+	// otherwise skipped at any depth as go test ./... does, whatever
+	// Ignores, so vendored code of one's own can be covered.
+	IncludeVendor bool
+
+	// MaxDepth, when above 0, skips the directories more than that many
+	// levels below the project directory without walking them, for deep
+	// trees whose tests are all near the top. 0 means no limit.
+	MaxDepth int
+
+	// SkipIncompatible skips the packages whose files are all excluded by
+	// the build constraints, as asked of go list with the Env and build
+	// tags go test would be run with, so those of another platform don't
+	// fail the run with "build constraints exclude all Go files". Without
+	// it only the constraints of the platform overalls runs on are checked.
+	SkipIncompatible bool
+
+	// ChangedSince is a git ref, such as origin/main, limiting the run to
+	// the packages holding a file changed since it, in git diff's terms:
+	// committed or not, untracked files aside. When git can't tell, outside
+	// a repository or for an unknown ref, every package is tested with a
+	// warning.
+	ChangedSince string
+
+	// ChangedDependents, with ChangedSince, also tests the packages of the
+	// project importing a changed one, directly or not, or whose tests do,
+	// as listed by go list.
+	ChangedDependents bool
+
+	// UseGitignore also skips the directories ignored by the .gitignore
+	// files in the project, on top of Ignores.
+	UseGitignore bool
+
+	// Includes is a list of directories to test, relative to the project
+	// path, in the same form as Ignores. When empty every directory is
+	// tested, otherwise only those matching one of Includes. Ignores takes
+	// precedence.
+	Includes []string
+
+	// Concurrency is the maximum number of packages to test at the same
+	// time. Defaults to the number of CPUs.
+	Concurrency int
+
+	// Parallel is passed to each go test invocation as -parallel when above
+	// 0, limiting how many t.Parallel tests of a package run at once. It
+	// applies within each package, Concurrency across them, so up to
+	// Concurrency times Parallel tests may run at the same time.
+	Parallel int
+
+	// FailFast stops the run once a package fails, killing the packages
+	// still being tested, instead of testing every package and reporting
+	// all failures.
+	FailFast bool
+
+	// MaxFailures, when above 0, stops the run as FailFast does once that
+	// many packages have failed, past which the run is clearly broken,
+	// the coverage collected so far being written. 0 means no limit.
+	MaxFailures int
+
+	// JSONEvents runs go test with -json, counting the tests of each
+	// package that passed, failed and were skipped in PackageResult.Tests.
+	// The output logged is still the text go test would print.
+	JSONEvents bool
+
+	// Retries is how many more times go test is run for a package whose
+	// tests fail before it is marked as failed.
+	Retries int
+
+	// RetryBackoff is how long to wait before each retry, for tests failing
+	// on resources still held from the last attempt. The wait ends early
+	// when the run is canceled, the package then not being retried.
+	RetryBackoff time.Duration
+
+	// RetryExponential doubles RetryBackoff after each retry of a package.
+	RetryExponential bool
+
+	// Timeout is passed to each go test invocation as -timeout. A package
+	// still running a minute after this is killed and marked as failed.
+	// With GoTestTimeout it is only how long a package may run before it is
+	// killed, a last resort for the rare hang go test can't time out.
+	Timeout time.Duration
+
+	// GoTestTimeout, when set, is passed to each go test invocation as
+	// -timeout instead of Timeout. A test running longer fails with the
+	// stack of every goroutine, far more telling than being killed. A
+	// package still running a minute after this is killed, unless Timeout
+	// sets how long it may run, which must then be longer.
+	GoTestTimeout time.Duration
+
+	// Output is the file the merged coverprofile is written to, relative
+	// paths are resolved against the current directory, and "-" writes it
+	// to standard output. Defaults to 'overalls.coverprofile' in the project
+	// directory. Missing directories are created, as they are for
+	// Cobertura, lcov and HTML. While testing, the coverage collected so
+	// far is written to a temporary file beside Output, named after it and
+	// ending in '.partial', renamed to Output once done, so Output is never
+	// seen half written, runs sharing it don't write over each other's file
+	// and a run that is killed leaves its coverage in the .partial file.
+	Output string
+
+	// OutputMode is the mode line written to Output, one of set, count or
+	// atomic, for tools that expect a particular one. Defaults to CoverMode,
+	// the mode the profiles were generated with, and a warning is logged
+	// when it differs as the counts are written unchanged.
+	OutputMode string
+
+	// Stdout is where an Output of "-" is written, os.Stdout when nil.
+	Stdout io.Writer
+
+	// Merge is an existing coverprofile, generated with the same
+	// covermode, whose blocks are merged into Output along with those of
+	// the tested packages. Relative paths are resolved against the current
+	// directory.
+	Merge string
+
+	// ProfileName is the file name of the coverprofile go test writes in
+	// each package directory, defaults to 'profile.coverprofile'. Set it when
+	// a package has a file of that name or other tooling writes one.
+	ProfileName string
+
+	// KeepProfiles leaves the ProfileName file go test writes in each
+	// package directory, which is otherwise removed once read.
+	KeepProfiles bool
+
+	// CPUProfile, MemProfile and BlockProfile are file names passed to
+	// each go test invocation as -cpuprofile, -memprofile and
+	// -blockprofile. Like ProfileName they are written in each package
+	// directory, along with the test binary pprof reads them with, and are
+	// left there. They multiply what a run writes by the number of packages
+	// so are meant for targeted runs, say with Includes.
+	CPUProfile   string
+	MemProfile   string
+	BlockProfile string
+
+	// Cobertura is a file the merged coverage is also written to as a
+	// Cobertura XML report, relative paths are resolved against the
+	// current directory.
+	Cobertura string
+
+	// Lcov is a file the merged coverage is also written to as an lcov
+	// tracefile, for editors and tools reading that format, relative paths
+	// are resolved against the current directory.
+	Lcov string
+
+	// HTML is a file the merged coverage is also written to as the HTML
+	// report of 'go tool cover -html', relative paths are resolved against
+	// the current directory. Failing to write it is logged, the coverprofile
+	// having already been written.
+	HTML string
+
+	// SplitOutput is a directory each package's coverprofile is also
+	// written to, as go test wrote it, at the package's import path with
+	// '.coverprofile' appended, for tooling analyzing coverage per package
+	// or module. Relative paths are resolved against the current directory.
+	// Profiles of earlier runs are overwritten but never removed, and
+	// failing to write one is logged.
+	SplitOutput string
+
+	// CoverallsToken, when set, is the repo token the merged coverage is
+	// posted to Coveralls with once written, along with the git commit and
+	// branch of the first project's directory.
+	CoverallsToken string
+
+	// PrefixReplace, in the form old=new, replaces the prefix old of each
+	// file path in the merged coverprofile with new, so a profile generated
+	// in one place, such as a container, matches the source tree it is
+	// uploaded from. The summary and Cobertura report are unaffected.
+	PrefixReplace string
+
+	// Tags is a comma separated list of build tags passed to each go test
+	// invocation as -tags. Directories whose test files are all excluded by
+	// build constraints under these tags are skipped.
+	Tags string
+
+	// TagsMap sets the build tags of some packages, for repositories whose
+	// packages need different ones. Each entry is pattern=tags, pattern
+	// taking the same form as Ignores and matched against the package's
+	// directory relative to the project, or the nested module holding it.
+	// The tags of the first entry matching are used instead of Tags, both
+	// for go test and to tell which directories have test files. Prebuild
+	// and ChangedDependents use Tags.
+	TagsMap []string
+
+	// CoverPkg is passed to each go test invocation as -coverpkg.
+	CoverPkg string
+
+	// ExcludeFiles are patterns of files, such as generated code, whose
+	// coverage is dropped from every profile before it is merged or
+	// summarized. They take the same form as Ignores, matched against the
+	// file's import path, as in 'github.com/x/y/api/api.pb.go', or globs
+	// against its name too, so '*.pb.go' and 'mock_*.go' apply anywhere. The
+	// packages tested are unaffected.
+	ExcludeFiles []string
+
+	// FailUnder is the minimum percentage of statements the merged profile
+	// must cover, 0 never fails.
+	FailUnder float64
+
+	// PackageMinimums sets the minimum coverage of some packages, for
+	// critical packages to be held to more than others. Each entry is
+	// pattern=percent, pattern taking the same form as Ignores and matched
+	// against the import path of each package of Result.Summary, as in
+	// 'github.com/x/y/billing/...=90', the first entry matching applying.
+	// When set, packages matching none must reach FailUnder too.
+	PackageMinimums []string
+
+	// Baseline is a coverprofile, such as the Output of a run on the target
+	// branch, the merged coverage is compared with in Result.Delta.
+	// Relative paths are resolved against the current directory. It is
+	// compared as written to Output, so it should have been written with
+	// the same PrefixReplace.
+	Baseline string
+
+	// FailOnDecrease fails the run with ErrCoverageDecreased when the total
+	// coverage is below that of Baseline.
+	FailOnDecrease bool
+
+	// AllowBuildFailures quarantines the packages that fail to build, as
+	// happens in a large repository mid-refactor. They are still reported
+	// in Result.Packages, with BuildFailed set, but don't stop the run with
+	// FailFast or fail it with ErrPackagesFailed, the coverage of the rest
+	// being written as usual.
+	AllowBuildFailures bool
+
+	// RequireTests fails the run with ErrUntestedPackages when a package
+	// walked has no test files, Result.Untested listing them, to enforce
+	// that every package has tests. Directories excluded by Ignores,
+	// Includes or ChangedSince are not checked.
+	RequireTests bool
+
+	// AllowEmpty makes a run that tests no packages, say because Ignores or
+	// Includes exclude them all, succeed rather than fail with
+	// ErrNoPackages.
+	AllowEmpty bool
+
+	// DryRun walks the project and logs which packages would be tested and
+	// why others are skipped, without running go test or writing Output.
+	// The Result lists the packages that would be tested.
+	DryRun bool
+
+	// GoCmd is the go command used to run the tests, such as the path to a
+	// specific toolchain or a wrapper script. Defaults to "go" on the PATH.
+	GoCmd string
+
+	// Prebuild, one of build or vet, runs 'go build ./...' or 'go vet ./...'
+	// in each project directory before testing, with Tags, Mod and Env, so
+	// compile errors are reported once rather than by every package
+	// depending on them. vet also compiles the test files, and fails on its
+	// own findings. The run stops with ErrPrebuildFailed when either fails,
+	// go's output being logged. Ignores do not apply, and nested modules are
+	// left to go test.
+	Prebuild string
+
+	// Mod is passed to each go invocation for a module as -mod, one of
+	// readonly, vendor or mod, overriding any -mod in GOFLAGS. GOFLAGS is
+	// otherwise honored, the environment being inherited. It is not passed
+	// for projects resolved via GOPATH, where go rejects it.
+	Mod string
+
+	// TestArgs are passed as-is to each go test invocation, before the flags
+	// overalls adds. Flags taking a value may be given as -run=TestA or as
+	// -run TestA. Any from -args on are passed after the package, for the
+	// test binary.
+	TestArgs []string
+
+	// Env are KEY=VALUE environment variables set for each go test
+	// invocation on top of the current environment. Of duplicate keys the
+	// last is used.
+	Env []string
+
+	// FreshCache points GOCACHE at a new temporary directory for the go
+	// commands of the run, removed once it is done, so nothing is replayed
+	// from a shared or stale build cache and the user's is left untouched.
+	// Every package is built from scratch, making the run slower.
+	FreshCache bool
+
+	// Quiet only logs the go test output of packages that fail, and not
+	// which package is being tested.
+	Quiet bool
+
+	// QuietGo only logs the go test output of packages that fail, as Quiet
+	// does, but still which package is being tested. Each package's output
+	// is kept until it is done and logged at once, so even when testing
+	// concurrently it is not mixed with that of others.
+	QuietGo bool
+
+	// Debug enables debug messages.
+	Debug bool
+
+	// Logger receives the progress and go test output, nothing is logged
+	// when nil.
+	Logger *log.Logger
+
+	// ErrLogger, when set, receives what go test writes to stderr, such as
+	// compile errors, instead of Logger, so errors can be told apart from
+	// the rest of the output.
+	ErrLogger *log.Logger
+
+	// OnEvent, when set, is called as each package starts and finishes
+	// testing, from multiple goroutines at once.
+	OnEvent func(Event)
+}
+
+// Result is the outcome of a Run.
+type Result struct {
+	// Output is the path the merged coverprofile was written to.
+	Output string
+
+	// Coverage is the percentage of statements covered by the merged
+	// profile.
+	Coverage float64
+
+	// Packages holds every tested package, sorted by import path.
+	Packages []PackageResult
+
+	// Summary holds the coverage of each package directory found in the
+	// merged profile, sorted by package.
+	Summary []PackageCoverage
+
+	// Delta compares the coverage with Options.Baseline, nil without one.
+	Delta *Delta
+
+	// Untested holds the import path of each package walked that has no
+	// test files, in walk order.
+	Untested []string
+
+	// BelowMinimum holds each package of Summary whose coverage is below
+	// its minimum of Options.PackageMinimums, sorted by package.
+	BelowMinimum []PackageMinimum
+}
+
+// PackageMinimum is a package whose coverage is below its minimum.
+type PackageMinimum struct {
+	Package  string
+	Coverage float64
+	Minimum  float64
+}
+
+// PackageResult is the outcome of testing a single package.
+type PackageResult struct {
+	// ImportPath is the import path passed to go test.
+	ImportPath string
+
+	// Coverage is the percentage of statements covered by the package's
+	// tests.
+	Coverage float64
+
+	// Attempts is how many times go test was run, more than one when
+	// retried.
+	Attempts int
+
+	// Duration is how long testing the package took, including retries.
+	Duration time.Duration
+
+	// ExitCode is the exit status of the last go test run: 0 when it
+	// passed, 1 for test or build failures and 2 for invalid flags. It is
+	// -1 when go test was killed by a signal, could not be started or its
+	// coverprofile could not be read.
+	ExitCode int
+
+	// BuildFailed is set when the package or its tests failed to compile,
+	// rather than the tests failing. Err is then non-nil too.
+	BuildFailed bool
+
+	// Tests counts the package's tests by outcome, in the last go test
+	// run, with Options.JSONEvents only.
+	Tests TestCounts
+
+	// Err is non-nil when the package's tests could not be run or did not
+	// pass.
+	Err error
+}
+
+// buildError is the error of a go test run that failed to build the
+// package's test binary.
+type buildError struct {
+	err error
+}
+
+func (e buildError) Error() string {
+	return "build failed: " + e.err.Error()
+}
+
+func (e buildError) Unwrap() error {
+	return e.err
+}
+
+// EventType is the kind of an Event.
+type EventType string
+
+// The types of Event.
+const (
+	EventStart  EventType = "start"
+	EventDone   EventType = "done"
+	EventFailed EventType = "failed"
 )
 
-const (
-	defaultIgnores = ".git,vendor"
-	outFilename    = "overalls.coverprofile"
-	pkgFilename    = "profile.coverprofile"
-	SEPARATOR      = string(os.PathSeparator)
-)
+// Event reports the progress of a single package to Options.OnEvent.
+type Event struct {
+	Type EventType
+
+	// PackageResult is the outcome of testing the package, only its
+	// ImportPath is set for an EventStart.
+	PackageResult
+}
+
+// Failed returns the packages whose tests could not be run or did not pass.
+func (r Result) Failed() []PackageResult {
+	var failed []PackageResult
+
+	for _, p := range r.Packages {
+		if p.Err != nil {
+			failed = append(failed, p)
+		}
+	}
+
+	return failed
+}
+
+// Slowest returns the n packages that took longest to test, failed ones
+// included, slowest first. All packages are returned when n is larger than
+// their number.
+func (r Result) Slowest(n int) []PackageResult {
+	slowest := append([]PackageResult(nil), r.Packages...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].Duration > slowest[j].Duration })
+
+	if n < 0 {
+		n = 0
+	}
+
+	if n < len(slowest) {
+		slowest = slowest[:n]
+	}
+
+	return slowest
+}
+
+// project is a single project directory tested by a run.
+type project struct {
+	// path is the directory to walk, ending with a separator.
+	path string
+
+	// pkgPath is the import path of path.
+	pkgPath string
+
+	// moduleRoot and modulePath are the directory and path of the module
+	// containing the project, empty in GOPATH mode.
+	moduleRoot string
+	modulePath string
+
+	// local is set for a directory outside of GOPATH and any module, whose
+	// packages are tested by their directory rather than import path.
+	local bool
+
+	// changed, when not nil, holds the only directories to test relative
+	// to path, as found for Options.ChangedSince.
+	changed map[string]bool
+}
+
+// importPath returns the import path of the package at rel, relative to the
+// project directory.
+func (p project) importPath(rel string) string {
+	if len(rel) == 0 {
+		return p.pkgPath
+	}
+
+	return p.pkgPath + "/" + slashPath(rel)
+}
+
+// testArg returns the package argument to go test for the package at rel,
+// relative to the project directory.
+func (p project) testArg(rel string) string {
+	if !p.local {
+		return p.importPath(rel)
+	}
+
+	if len(rel) == 0 {
+		return "."
+	}
+
+	return "./" + slashPath(rel)
+}
+
+// slashPath returns the filesystem path rel with each separator replaced by
+// a forward slash, as import paths and go test's package arguments use them
+// whatever the OS.
+func slashPath(rel string) string {
+	if separator == "/" {
+		return rel
+	}
+
+	return strings.Replace(rel, separator, "/", -1)
+}
+
+// runner holds the state of a single Run.
+type runner struct {
+	// ctx is done when the caller's context, parent, is or, with
+	// FailFast or MaxFailures, once stop is called after packages fail.
+	ctx           context.Context
+	parent        context.Context
+	stop          context.CancelFunc
+	opts          Options
+	logger        *log.Logger
+	errLogger     *log.Logger
+	projects      []project
+	outputPath    string
+	mergePath     string
+	baselinePath  string
+	coberturaPath string
+	lcovPath      string
+	htmlPath      string
+	splitPath     string
+	prefixOld     string
+	prefixNew     string
+	ignores       patterns
+	includes      patterns
+	excludes      patterns
+	tagsMap       []tagsRule
+	minimums      []minimumRule
+	results       results
+
+	// nested are the modules found below the projects while walking them.
+	nested []project
+
+	// untested are the packages without test files found while walking.
+	untested []string
+
+	// failures counts the packages that failed, for MaxFailures.
+	failures int32
+
+	// carried are the blocks Watch keeps from its last run, merged into the
+	// profile for the packages not tested again.
+	carried []block
+
+	// blocks are the merged blocks of the run once written, for Watch to
+	// carry over.
+	blocks []block
+}
+
+// results collects the PackageResult of each tested package, it is written
+// to by the concurrent processDIR goroutines.
+type results struct {
+	mu       sync.Mutex
+	packages []PackageResult
+}
+
+// add records res.
+func (rs *results) add(res PackageResult) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.packages = append(rs.packages, res)
+}
+
+// sorted returns a copy of the recorded results sorted by import path.
+func (rs *results) sorted() []PackageResult {
+	rs.mu.Lock()
+	packages := append([]PackageResult(nil), rs.packages...)
+	rs.mu.Unlock()
+
+	sort.Slice(packages, func(i, j int) bool { return packages[i].ImportPath < packages[j].ImportPath })
+
+	return packages
+}
+
+// Run recursively traverses the project's directory structure running
+// 'go test -coverprofile' in each directory with go test files, and
+// concatenates the results into a single coverprofile.
+//
+// Run changes the working directory to the project directory, the first
+// one when there are several, for its duration, so it must not be called
+// concurrently.
+func Run(opts Options) (Result, error) {
+	return RunContext(context.Background(), opts)
+}
+
+// RunContext is like Run but stops when ctx is done, killing any running
+// go test processes and writing the coverage collected so far before
+// returning ctx.Err().
+func RunContext(ctx context.Context, opts Options) (Result, error) {
+	r := &runner{ctx: ctx, parent: ctx, opts: opts}
+
+	if err := r.init(); err != nil {
+		return Result{}, err
+	}
+
+	return r.run()
+}
+
+// run tests the packages of the initialized runner as RunContext does.
+func (r *runner) run() (Result, error) {
+	if r.opts.FailFast || r.opts.MaxFailures > 0 {
+		r.ctx, r.stop = context.WithCancel(r.parent)
+		defer r.stop()
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err = os.Chdir(r.projects[0].path); err != nil {
+		return Result{}, fmt.Errorf("invalid project path '%s'\n%s", r.opts.Project, err)
+	}
+	defer os.Chdir(wd)
+
+	if r.opts.Debug {
+		r.logger.Println("Working DIR:", r.projects[0].path)
+		r.logger.Println("Module mode:", r.moduleMode())
+	}
+
+	if r.opts.DryRun {
+		return r.dryRun()
+	}
+
+	if r.opts.FreshCache {
+		cache, err := ioutil.TempDir("", "overalls-gocache")
+		if err != nil {
+			return Result{}, fmt.Errorf("unable to create a fresh GOCACHE\n%s", err)
+		}
+		defer os.RemoveAll(cache)
+
+		// exec uses the last value of duplicate keys
+		r.opts.Env = append(append([]string(nil), r.opts.Env...), "GOCACHE="+cache)
+
+		if r.opts.Debug {
+			r.logger.Println("GOCACHE:", cache)
+		}
+	}
+
+	return r.testFiles()
+}
+
+// List returns the import paths of the packages Run would test with opts, in
+// the order it would walk them, without running go test or writing
+// anything. Unlike Options.DryRun it is for programs rather than people,
+// only warnings and debug messages are logged.
+func List(ctx context.Context, opts Options) ([]string, error) {
+	r := &runner{ctx: ctx, parent: ctx, opts: opts}
+
+	if err := r.init(); err != nil {
+		return nil, err
+	}
+
+	var packages []string
+
+	for _, p := range r.projects {
+		err := r.walk(p, func(mod project, fullPath, relPath string) error {
+			packages = append(packages, mod.importPath(relPath))
+			return nil
+		})
+		if err != nil && err != r.ctx.Err() {
+			return packages, fmt.Errorf("could not walk project path '%s'\n%s", p.path, err)
+		}
+	}
+
+	return packages, r.ctx.Err()
+}
+
+// CheckCoverMode returns the error Run gives for the covermode mode, empty
+// for the default, along with race and strict as Options.Race and
+// Options.StrictCoverMode. It lets callers check the mode before any other
+// option.
+func CheckCoverMode(mode string, race, strict bool) error {
+	switch mode {
+	case "", "atomic":
+	case "set", "count":
+		if race && strict {
+			return fmt.Errorf("invalid covermode '%s', -race requires atomic", mode)
+		}
+	default:
+		return fmt.Errorf("invalid covermode '%s', must be set, count or atomic", mode)
+	}
+
+	return nil
+}
+
+// init validates the options, filling in defaults, and resolves the
+// directory to walk and the import path prefix of that directory for each
+// project.
+func (r *runner) init() error {
+	r.logger = r.opts.Logger
+	if r.logger == nil {
+		r.logger = log.New(ioutil.Discard, "", 0)
+	}
+
+	r.errLogger = r.opts.ErrLogger
+	if r.errLogger == nil {
+		r.errLogger = r.logger
+	}
+
+	// the covermode is checked first, its errors being the same whatever
+	// the project
+	if err := CheckCoverMode(r.opts.CoverMode, r.opts.Race, r.opts.StrictCoverMode); err != nil {
+		return err
+	}
+
+	switch r.opts.CoverMode {
+	case "":
+		r.opts.CoverMode = "count"
+		if r.opts.Race {
+			r.opts.CoverMode = "atomic"
+		}
+	case "set", "count":
+		if r.opts.Race {
+			r.logger.Printf("WARNING: -race requires covermode atomic, using atomic instead of '%s'\n", r.opts.CoverMode)
+			r.opts.CoverMode = "atomic"
+		}
+	}
+
+	switch r.opts.OutputMode {
+	case "":
+		r.opts.OutputMode = r.opts.CoverMode
+	case "set", "count", "atomic":
+		if r.opts.OutputMode != r.opts.CoverMode {
+			r.logger.Printf("WARNING: output-mode '%s' differs from covermode '%s' the profiles are generated with\n", r.opts.OutputMode, r.opts.CoverMode)
+		}
+	default:
+		return fmt.Errorf("invalid output-mode '%s', must be set, count or atomic", r.opts.OutputMode)
+	}
+
+	if len(r.opts.Project) == 0 {
+		return fmt.Errorf("invalid project path '%s'", r.opts.Project)
+	}
+
+	switch {
+	case r.opts.Concurrency == 0:
+		r.opts.Concurrency = runtime.NumCPU()
+	case r.opts.Concurrency < 0:
+		return fmt.Errorf("invalid concurrency '%d', must be at least 1", r.opts.Concurrency)
+	}
+
+	if len(r.opts.GoCmd) == 0 {
+		r.opts.GoCmd = "go"
+	}
+
+	if r.opts.Stdout == nil {
+		r.opts.Stdout = os.Stdout
+	}
+
+	switch name := r.opts.ProfileName; {
+	case len(name) == 0:
+		r.opts.ProfileName = pkgFilename
+	case name != filepath.Base(name) || name == "." || name == "..":
+		return fmt.Errorf("invalid profile-name '%s', must be a file name", name)
+	}
+
+	for _, f := range []struct{ flag, name string }{
+		{"cpuprofile", r.opts.CPUProfile},
+		{"memprofile", r.opts.MemProfile},
+		{"blockprofile", r.opts.BlockProfile},
+	} {
+		if len(f.name) > 0 && (f.name != filepath.Base(f.name) || f.name == "." || f.name == ".." || f.name == r.opts.ProfileName) {
+			return fmt.Errorf("invalid %s '%s', must be a file name other than the profile-name", f.flag, f.name)
+		}
+	}
+
+	if r.opts.Timeout < 0 {
+		return fmt.Errorf("invalid timeout '%s', must not be negative", r.opts.Timeout)
+	}
+
+	if r.opts.GoTestTimeout < 0 {
+		return fmt.Errorf("invalid go-test-timeout '%s', must not be negative", r.opts.GoTestTimeout)
+	}
+
+	// killed first, go test would never get to print the stacks
+	if r.opts.GoTestTimeout > 0 && r.opts.Timeout > 0 && r.opts.Timeout <= r.opts.GoTestTimeout {
+		return fmt.Errorf("invalid timeout '%s', must be longer than go-test-timeout '%s'", r.opts.Timeout, r.opts.GoTestTimeout)
+	}
+
+	if _, _, err := splitTestArgs(r.opts.TestArgs); err != nil {
+		return err
+	}
+
+	if r.opts.Count < 0 {
+		return fmt.Errorf("invalid count '%d', must not be negative", r.opts.Count)
+	}
+
+	switch r.opts.Prebuild {
+	case "", "build", "vet":
+	default:
+		return fmt.Errorf("invalid prebuild '%s', must be build or vet", r.opts.Prebuild)
+	}
+
+	switch r.opts.Mod {
+	case "", "readonly", "vendor", "mod":
+	default:
+		return fmt.Errorf("invalid mod '%s', must be readonly, vendor or mod", r.opts.Mod)
+	}
+
+	if r.opts.MaxDepth < 0 {
+		return fmt.Errorf("invalid max-depth '%d', must not be negative", r.opts.MaxDepth)
+	}
+
+	if r.opts.MaxFailures < 0 {
+		return fmt.Errorf("invalid max-failures '%d', must not be negative", r.opts.MaxFailures)
+	}
+
+	if r.opts.Parallel < 0 {
+		return fmt.Errorf("invalid parallel '%d', must not be negative", r.opts.Parallel)
+	}
+
+	if r.opts.Retries < 0 {
+		return fmt.Errorf("invalid retries '%d', must not be negative", r.opts.Retries)
+	}
+
+	if r.opts.RetryBackoff < 0 {
+		return fmt.Errorf("invalid retry-backoff '%s', must not be negative", r.opts.RetryBackoff)
+	}
+
+	if r.opts.FailUnder < 0 || r.opts.FailUnder > 100 {
+		return fmt.Errorf("invalid fail-under '%g', must be between 0 and 100", r.opts.FailUnder)
+	}
+
+	for _, kv := range r.opts.Env {
+		if strings.Index(kv, "=") < 1 {
+			return fmt.Errorf("invalid env '%s', must be KEY=VALUE", kv)
+		}
+	}
+
+	if len(r.opts.PrefixReplace) > 0 {
+		i := strings.Index(r.opts.PrefixReplace, "=")
+		if i < 1 {
+			return fmt.Errorf("invalid prefix-replace '%s', must be old=new", r.opts.PrefixReplace)
+		}
+
+		r.prefixOld, r.prefixNew = r.opts.PrefixReplace[:i], r.opts.PrefixReplace[i+1:]
+	}
+
+	if r.opts.Ignores == nil {
+		r.opts.Ignores = DefaultIgnores
+	}
+
+	var err error
+	if r.ignores, err = newPatterns(r.opts.Ignores); err != nil {
+		return fmt.Errorf("invalid ignore: %s", err)
+	}
+
+	if r.includes, err = newPatterns(r.opts.Includes); err != nil {
+		return fmt.Errorf("invalid include: %s", err)
+	}
+
+	if r.excludes, err = newPatterns(r.opts.ExcludeFiles); err != nil {
+		return fmt.Errorf("invalid exclude-files: %s", err)
+	}
+
+	for _, entry := range r.opts.TagsMap {
+		i := strings.Index(entry, "=")
+		if i < 1 {
+			return fmt.Errorf("invalid tags-map '%s', must be pattern=tags", entry)
+		}
+
+		ps, err := newPatterns([]string{entry[:i]})
+		if err != nil {
+			return fmt.Errorf("invalid tags-map: %s", err)
+		}
+
+		r.tagsMap = append(r.tagsMap, tagsRule{patterns: ps, tags: entry[i+1:]})
+	}
+
+	for _, entry := range r.opts.PackageMinimums {
+		rule, err := parseMinimum(entry)
+		if err != nil {
+			return err
+		}
+
+		r.minimums = append(r.minimums, rule)
+	}
+
+	// git would take it as an option
+	if strings.HasPrefix(r.opts.ChangedSince, "-") {
+		return fmt.Errorf("invalid changed-since '%s', must be a git ref", r.opts.ChangedSince)
+	}
+
+	if len(r.opts.Root) > 0 && len(r.opts.Projects) > 0 {
+		return fmt.Errorf("invalid root '%s', can't be used with several projects", r.opts.Root)
+	}
+
+	for _, name := range append([]string{r.opts.Project}, r.opts.Projects...) {
+		var p project
+		if len(r.opts.Root) > 0 {
+			p, err = r.rootProject()
+		} else {
+			p, err = r.resolveProject(name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(r.opts.ChangedSince) > 0 {
+			p.changed = r.changedDirs(p)
+		}
+
+		r.projects = append(r.projects, p)
+	}
+
+	// resolve before changing into the project directory so a relative
+	// output is relative to the current directory
+	switch {
+	case r.opts.Output == "-":
+		r.outputPath = r.opts.Output
+	case len(r.opts.Output) > 0:
+		if r.outputPath, err = filepath.Abs(r.opts.Output); err != nil {
+			return fmt.Errorf("invalid output path '%s'\n%s", r.opts.Output, err)
+		}
+	default:
+		r.outputPath = r.projects[0].path + outFilename
+	}
+
+	if len(r.opts.Merge) > 0 {
+		if r.mergePath, err = filepath.Abs(r.opts.Merge); err != nil {
+			return fmt.Errorf("invalid merge path '%s'\n%s", r.opts.Merge, err)
+		}
+	}
+
+	if len(r.opts.Baseline) > 0 {
+		if r.baselinePath, err = filepath.Abs(r.opts.Baseline); err != nil {
+			return fmt.Errorf("invalid baseline path '%s'\n%s", r.opts.Baseline, err)
+		}
+	} else if r.opts.FailOnDecrease {
+		return errors.New("invalid fail-on-decrease, requires a baseline")
+	}
+
+	if len(r.opts.Cobertura) > 0 {
+		if r.coberturaPath, err = filepath.Abs(r.opts.Cobertura); err != nil {
+			return fmt.Errorf("invalid cobertura path '%s'\n%s", r.opts.Cobertura, err)
+		}
+	}
+
+	if len(r.opts.Lcov) > 0 {
+		if r.lcovPath, err = filepath.Abs(r.opts.Lcov); err != nil {
+			return fmt.Errorf("invalid lcov path '%s'\n%s", r.opts.Lcov, err)
+		}
+	}
+
+	if len(r.opts.HTML) > 0 {
+		if r.htmlPath, err = filepath.Abs(r.opts.HTML); err != nil {
+			return fmt.Errorf("invalid html path '%s'\n%s", r.opts.HTML, err)
+		}
+	}
+
+	if len(r.opts.SplitOutput) > 0 {
+		if r.splitPath, err = filepath.Abs(r.opts.SplitOutput); err != nil {
+			return fmt.Errorf("invalid split-output path '%s'\n%s", r.opts.SplitOutput, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveProject returns the directory to walk and the import path prefix of
+// that directory for the project path name.
+func (r *runner) resolveProject(name string) (project, error) {
+	if len(name) == 0 {
+		return project{}, fmt.Errorf("invalid project path '%s'", name)
+	}
+
+	raw := name
+	name = filepath.Clean(name)
+
+	if r.opts.Debug {
+		r.logger.Println("Project Path:", name)
+	}
+
+	var p project
+	var err error
+
+	p.moduleRoot, p.modulePath = findModule(name)
+
+	if len(p.moduleRoot) > 0 {
+		if r.opts.Debug {
+			r.logger.Println("Module:", p.modulePath, "in", p.moduleRoot)
+		}
+
+		if p.path, p.pkgPath, err = p.moduleProject(name); err != nil {
+			return project{}, err
+		}
+
+		return p, nil
+	}
+
+	gopath := filepath.Clean(GoPath())
+
+	if r.opts.Debug {
+		r.logger.Println("GOPATH:", gopath)
+	}
+
+	if isDirPath(raw) {
+		return dirProject(name, gopath)
+	}
+
+	if len(gopath) == 0 || gopath == "." {
+		return project{}, fmt.Errorf("invalid GOPATH '%s'", gopath)
+	}
+
+	p.path = gopath + separator + "src" + separator + name + separator
+	p.pkgPath = name
+
+	return p, nil
+}
+
+// rootProject returns the project walking the directory Options.Root, whose
+// import path is Options.Project.
+func (r *runner) rootProject() (project, error) {
+	abs, err := filepath.Abs(r.opts.Root)
+	if err != nil {
+		return project{}, fmt.Errorf("invalid root '%s'\n%s", r.opts.Root, err)
+	}
+
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return project{}, fmt.Errorf("invalid root '%s', must be a directory", r.opts.Root)
+	}
+
+	p := project{path: abs + separator, pkgPath: slashPath(filepath.Clean(r.opts.Project))}
+
+	if os.Getenv("GO111MODULE") != "off" {
+		if modPath := modulePath(abs); len(modPath) > 0 {
+			p.moduleRoot, p.modulePath = abs, modPath
+		}
+	}
+
+	if r.opts.Debug {
+		r.logger.Println("Root:", p.path, "as", p.pkgPath)
+	}
+
+	return p, nil
+}
+
+// isDirPath reports whether the project path name is a filesystem path,
+// absolute or starting with './' or '../', rather than relative to GOPATH.
+func isDirPath(name string) bool {
+	name = filepath.ToSlash(name)
+
+	return filepath.IsAbs(name) || name == "." || name == ".." ||
+		strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../")
+}
+
+// dirProject returns the project for the directory dir, named by its import
+// path when within gopath and tested by directory otherwise.
+func dirProject(dir, gopath string) (project, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return project{}, fmt.Errorf("invalid project path '%s'\n%s", dir, err)
+	}
+
+	p := project{path: abs + separator}
+
+	if len(gopath) > 0 && gopath != "." {
+		rel, err := filepath.Rel(filepath.Join(gopath, "src"), abs)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+separator) {
+			p.pkgPath = slashPath(rel)
+			return p, nil
+		}
+	}
+
+	// the import path go gives packages outside of GOPATH
+	p.pkgPath = "_" + filepath.ToSlash(abs)
+	p.local = true
+
+	return p, nil
+}
+
+// GoPath returns the GOPATH environment variable or, when it is unset, the
+// GOPATH reported by 'go env', which defaults to '~/go'. An empty string is
+// returned when neither is available.
+func GoPath() string {
+	if gopath := os.Getenv("GOPATH"); len(gopath) > 0 {
+		return gopath
+	}
+
+	b, err := exec.Command("go", "env", "GOPATH").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// findModule looks for a go.mod file in the project directory, treating
+// project as a filesystem path, and then in the current directory, each
+// time walking up to the first parent holding one as the go command does. It
+// returns the directory containing the go.mod and the module path declared
+// in it, or empty strings when the project should be resolved via GOPATH.
+func findModule(project string) (root, path string) {
+	if os.Getenv("GO111MODULE") == "off" {
+		return "", ""
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", ""
+	}
+
+	dirs := []string{project, wd}
+	if !filepath.IsAbs(project) {
+		dirs[0] = filepath.Join(wd, project)
+	}
+
+	for _, dir := range dirs {
+		for {
+			if path := modulePath(dir); len(path) > 0 {
+				return dir, path
+			}
+
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+
+	return "", ""
+}
+
+// modulePath returns the module path declared by the go.mod in dir, or an
+// empty string when there is none.
+func modulePath(dir string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+
+	if m := moduleRegex.FindSubmatch(b); m != nil {
+		return string(m[1])
+	}
+
+	return ""
+}
+
+// moduleProject returns the directory to walk and the import path prefix of
+// that directory, for a project living inside the module at p.moduleRoot.
+// name may be a filesystem path or an import path within the module.
+func (p project) moduleProject(name string) (dir, importPath string, err error) {
+	var rel string
+
+	switch {
+	case name == p.modulePath:
+		rel = "."
+	case strings.HasPrefix(name, p.modulePath+"/"):
+		rel = filepath.FromSlash(strings.TrimPrefix(name, p.modulePath+"/"))
+	default:
+		abs, err := filepath.Abs(name)
+		if err == nil {
+			rel, err = filepath.Rel(p.moduleRoot, abs)
+		}
+
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+separator) {
+			return "", "", fmt.Errorf("invalid project path '%s', not within module '%s'", name, p.modulePath)
+		}
+	}
+
+	if rel == "." {
+		return p.moduleRoot + separator, p.modulePath, nil
+	}
+
+	return filepath.Join(p.moduleRoot, rel) + separator, p.modulePath + "/" + slashPath(rel), nil
+}
+
+func scanOutput(wg *sync.WaitGroup, r io.Reader, fn func(...interface{})) {
+	defer wg.Done()
+	bs := bufio.NewScanner(r)
+	for bs.Scan() {
+		fn(bs.Text())
+	}
+	if err := bs.Err(); err != nil {
+		fn(fmt.Sprintf("Scan error: %v", err.Error()))
+	}
+}
+
+// addResult records the outcome of testing a package, it is safe to call
+// from multiple processDIR goroutines.
+func (r *runner) addResult(res PackageResult) {
+	r.results.add(res)
+
+	if res.Err != nil {
+		r.event(Event{Type: EventFailed, PackageResult: res})
+	} else {
+		r.event(Event{Type: EventDone, PackageResult: res})
+	}
+}
+
+// event passes e to OnEvent, when set.
+func (r *runner) event(e Event) {
+	if r.opts.OnEvent != nil {
+		r.opts.OnEvent(e)
+	}
+}
+
+// processDIR tests the package at relPath of p, recording its result, and
+// sends its coverprofile on out only when it passed. Failing packages send
+// nothing, the collector instead ending once wg, marked done however the
+// package ends, closes out, so it never waits on a profile that won't come.
+func (r *runner) processDIR(wg *sync.WaitGroup, sem <-chan struct{}, p project, fullPath, relPath string, out chan<- []byte) {
+	defer wg.Done()
+
+	start := time.Now()
+	pkg := p.importPath(relPath)
+	r.event(Event{Type: EventStart, PackageResult: PackageResult{ImportPath: pkg}})
+
+	attempts := 1
+	b, tests, err := r.testDIR(p, fullPath, relPath)
+
+	// each attempt gets a fresh timeout, a canceled run or build failure is
+	// not retried
+	for ; err != nil && !isBuildError(err) && attempts <= r.opts.Retries && r.ctx.Err() == nil; attempts++ {
+		wait := r.retryBackoff(attempts)
+		if wait > 0 {
+			r.logger.Printf("Retrying %s (%d/%d) in %s after: %s\n", pkg, attempts, r.opts.Retries, wait, err)
+		} else {
+			r.logger.Printf("Retrying %s (%d/%d) after: %s\n", pkg, attempts, r.opts.Retries, err)
+		}
+
+		if !r.sleep(wait) {
+			break
+		}
+
+		b, tests, err = r.testDIR(p, fullPath, relPath)
+	}
+
+	code := exitCode(err)
+
+	if err == nil {
+		err = checkMode(r.opts.CoverMode, b)
+	}
+
+	quarantined := err != nil && r.opts.AllowBuildFailures && isBuildError(err)
+
+	// stop before releasing the slot so the walk starts no more packages
+	if err != nil && !quarantined {
+		r.failFast(pkg)
+	}
+
+	// release the slot before sending so the next package starts while
+	// this profile is merged
+	<-sem
+
+	if err != nil {
+		if quarantined {
+			r.logger.Println("WARNING: quarantining", pkg, err)
+		} else {
+			r.logger.Println("ERROR:", pkg, err)
+		}
+		r.addResult(PackageResult{ImportPath: pkg, Attempts: attempts, Duration: time.Since(start), ExitCode: code, BuildFailed: isBuildError(err), Tests: tests, Err: err})
+		return
+	}
+
+	r.addResult(PackageResult{
+		ImportPath: pkg,
+		Coverage:   percentCovered(excludeBlocks(parseBlocks(string(b)), r.excludes)),
+		Attempts:   attempts,
+		Duration:   time.Since(start),
+		Tests:      tests,
+	})
+
+	if len(r.splitPath) > 0 && b != nil {
+		r.writeSplit(pkg, b)
+	}
+
+	out <- b
+}
+
+// writeSplit writes the coverprofile b of the package pkg below SplitOutput.
+func (r *runner) writeSplit(pkg string, b []byte) {
+	path := filepath.Join(r.splitPath, filepath.FromSlash(pkg)) + ".coverprofile"
+
+	err := createParent(path)
+	if err == nil {
+		err = ioutil.WriteFile(path, b, 0644)
+	}
+
+	if err != nil {
+		r.logger.Printf("WARNING: unable to write the coverprofile of %s to '%s'\n%s\n", pkg, path, err)
+	}
+}
+
+// failFast stops the run after the package pkg failed, when FailFast is set
+// or MaxFailures packages have.
+func (r *runner) failFast(pkg string) {
+	n := atomic.AddInt32(&r.failures, 1)
+
+	if r.stop == nil || r.ctx.Err() != nil {
+		return
+	}
+
+	switch {
+	case r.opts.FailFast:
+		r.logger.Printf("Stopping after %s failed, -fail-fast is set\n", pkg)
+	case int(n) >= r.opts.MaxFailures:
+		r.logger.Printf("Stopping after %s failed, %d packages failed and -max-failures is %d\n", pkg, n, r.opts.MaxFailures)
+	default:
+		return
+	}
+
+	r.stop()
+}
+
+// buildFailure returns the buildError for the go test run that failed with
+// err, naming the import path problem reported by the line unresolved, if
+// any, which is otherwise easily lost in go's output.
+func buildFailure(unresolved string, err error) error {
+	if len(unresolved) > 0 {
+		err = fmt.Errorf("unresolved import path, %s: %w", strings.TrimSuffix(strings.TrimSpace(unresolved), ":"), err)
+	}
+
+	return buildError{err}
+}
+
+// isBuildError reports whether err is from a go test run that failed to
+// build the package.
+func isBuildError(err error) bool {
+	var be buildError
+	return errors.As(err, &be)
+}
+
+// exitCode returns the exit status of the go test run that returned err, or
+// -1 when it did not exit on its own.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
+
+// retryBackoff returns how long to wait before the retry attempt, the first
+// being 1.
+func (r *runner) retryBackoff(attempt int) time.Duration {
+	wait := r.opts.RetryBackoff
+
+	if r.opts.RetryExponential {
+		// doubling stops short of overflowing
+		for i := 1; i < attempt && wait <= math.MaxInt64/2; i++ {
+			wait *= 2
+		}
+	}
+
+	return wait
+}
+
+// sleep waits for d, returning false without waiting it out when the run is
+// canceled first.
+func (r *runner) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return r.ctx.Err() == nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// testArgs returns the arguments to go test for the package at relPath in
+// fullPath. The package is always slash separated, the output directory uses
+// the OS separator.
+func (r *runner) testArgs(p project, fullPath, relPath string) []string {
+	// 1 for "test", 19 for json, mod, verbose, race, short, cpu, count, parallel, tags, timeout, coverpkg, cpuprofile, memprofile, blockprofile, o, covermode, coverprofile, outputdir, relpath
+	flags, binary, _ := splitTestArgs(r.opts.TestArgs)
+
+	args := make([]string, 1, 1+len(r.opts.TestArgs)+19)
+	args[0] = "test"
+	args = append(args, flags...)
+	if r.opts.JSONEvents {
+		args = append(args, "-json")
+	}
+	if len(r.opts.Mod) > 0 && len(p.moduleRoot) > 0 {
+		args = append(args, "-mod="+r.opts.Mod)
+	}
+	if r.opts.Verbose {
+		args = append(args, "-v")
+	}
+	if r.opts.Race {
+		args = append(args, "-race")
+	}
+	if r.opts.Short {
+		args = append(args, "-short")
+	}
+	if len(r.opts.CPU) > 0 {
+		args = append(args, "-cpu="+r.opts.CPU)
+	}
+	if r.opts.Count > 0 {
+		args = append(args, "-count="+strconv.Itoa(r.opts.Count))
+	}
+	if r.opts.Parallel > 0 {
+		args = append(args, "-parallel="+strconv.Itoa(r.opts.Parallel))
+	}
+	if tags := r.tagsFor(relPath); len(tags) > 0 {
+		args = append(args, "-tags="+tags)
+	}
+	if timeout := r.goTestTimeout(); timeout > 0 {
+		args = append(args, "-timeout="+timeout.String())
+	}
+	if len(r.opts.CoverPkg) > 0 {
+		args = append(args, "-coverpkg="+r.opts.CoverPkg)
+	}
+	if len(r.opts.CPUProfile) > 0 {
+		args = append(args, "-cpuprofile="+r.opts.CPUProfile)
+	}
+	if len(r.opts.MemProfile) > 0 {
+		args = append(args, "-memprofile="+r.opts.MemProfile)
+	}
+	if len(r.opts.BlockProfile) > 0 {
+		args = append(args, "-blockprofile="+r.opts.BlockProfile)
+	}
+	// profiling keeps the test binary, by default in the project directory
+	// where packages of the same name would overwrite each other's
+	if len(r.opts.CPUProfile) > 0 || len(r.opts.MemProfile) > 0 || len(r.opts.BlockProfile) > 0 {
+		args = append(args, "-o="+fullPath+separator)
+	}
+	args = append(args, "-covermode="+r.opts.CoverMode, "-coverprofile="+r.opts.ProfileName, "-outputdir="+fullPath+separator, p.testArg(relPath))
+	args = append(args, binary...)
+
+	return args
+}
+
+// testDIR runs go test, from the directory of the project p, for the package
+// at relPath in fullPath, returning the resulting coverprofile.
+func (r *runner) testDIR(p project, fullPath, relPath string) ([]byte, TestCounts, error) {
+	pkg := p.importPath(relPath)
+	args := r.testArgs(p, fullPath, relPath)
+
+	if !r.opts.Quiet {
+		r.logger.Printf("Test package: %v\n", pkg)
+	}
+
+	ctx := r.ctx
+	if kill := r.killAfter(); kill > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, kill)
+		defer cancel()
+	}
+
+	if !r.opts.KeepProfiles {
+		defer os.Remove(r.profilePath(fullPath))
+	}
+
+	// the working directory is shared by every project, so run from the
+	// project's own directory for go to find its module
+	cmd := exec.CommandContext(ctx, r.opts.GoCmd, args...)
+	cmd.Dir = p.path
+	killGroup(cmd)
+
+	// exec uses the last value of duplicate keys
+	if len(r.opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), r.opts.Env...)
+	}
+
+	if r.opts.Debug {
+		r.logger.Println("Processing:", strings.Join(cmd.Args, " "))
+	}
+
+	if r.opts.Quiet || r.opts.QuietGo {
+		return r.runQuiet(ctx, cmd, fullPath)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, TestCounts{}, errors.New("unable to get process stdout")
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, TestCounts{}, errors.New("unable to get process stderr")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, TestCounts{}, r.runError(ctx, err)
+	}
+
+	// the pipes must be read to the end before Wait closes them, and no
+	// output logged once the package is done
+	var scans sync.WaitGroup
+	scans.Add(2)
+
+	// only written by the stdout scan, go test prints its FAIL lines and
+	// -json events there
+	var events testEvents
+	buildFailed := false
+	go scanOutput(&scans, stdout, func(v ...interface{}) {
+		line := fmt.Sprint(v...)
+		if r.opts.JSONEvents {
+			if line = events.add(line); len(line) == 0 {
+				return
+			}
+		}
+		buildFailed = buildFailed || buildFailedRegex.MatchString(line)
+		r.logger.Print(line)
+	})
+
+	// only written by the stderr scan, where go reports import problems
+	var unresolved string
+	go scanOutput(&scans, stderr, func(v ...interface{}) {
+		if line := fmt.Sprint(v...); len(unresolved) == 0 && unresolvedRegex.MatchString(line) {
+			unresolved = line
+		}
+		r.errLogger.Print(v...)
+	})
+	scans.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		if buildFailed {
+			err = buildFailure(unresolved, err)
+		}
+		return nil, events.counts, r.runError(ctx, err)
+	}
+
+	b, err := r.readProfile(fullPath)
+
+	return b, events.counts, err
+}
+
+// runQuiet runs cmd, only logging its output when it fails.
+func (r *runner) runQuiet(ctx context.Context, cmd *exec.Cmd, fullPath string) ([]byte, TestCounts, error) {
+	// a single writer for both when logged together so exec does not
+	// write to it concurrently
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if r.errLogger == r.logger {
+		stderr = stdout
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+
+	var events testEvents
+	output := stdout.String()
+	if r.opts.JSONEvents {
+		output = events.decode(stdout.Bytes())
+	}
+
+	if err != nil {
+		if stderr != stdout && stderr.Len() > 0 {
+			r.errLogger.Print(stderr.String())
+		}
+		r.logger.Print(output)
+		if buildFailedRegex.MatchString(output) {
+			err = buildFailure(string(unresolvedRegex.Find(stderr.Bytes())), err)
+		}
+		return nil, events.counts, r.runError(ctx, err)
+	}
+
+	b, err := r.readProfile(fullPath)
+
+	return b, events.counts, err
+}
+
+// profilePath returns the path of the coverprofile go test writes for the
+// package in dir, which is passed as its -outputdir.
+func (r *runner) profilePath(dir string) string {
+	return dir + separator + r.opts.ProfileName
+}
+
+// readProfile reads the coverprofile go test wrote for the package in dir.
+// A missing profile contributes no coverage rather than failing the package.
+func (r *runner) readProfile(dir string) ([]byte, error) {
+	b, err := ioutil.ReadFile(r.profilePath(dir))
+	if os.IsNotExist(err) {
+		if r.opts.Debug {
+			r.logger.Printf("No coverprofile written for %s, no coverage contributed\n", dir)
+		}
+		return nil, nil
+	}
+
+	return b, err
+}
+
+// runError explains why a go test run with the context ctx failed.
+func (r *runner) runError(ctx context.Context, err error) error {
+	switch {
+	case r.ctx.Err() != nil:
+		return fmt.Errorf("canceled: %w", err)
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("killed after %s: %w", r.killAfter(), err)
+	}
+
+	return err
+}
+
+// goTestTimeout returns the -timeout passed to go test, 0 for go test's
+// default.
+func (r *runner) goTestTimeout() time.Duration {
+	if r.opts.GoTestTimeout > 0 {
+		return r.opts.GoTestTimeout
+	}
+
+	return r.opts.Timeout
+}
+
+// killAfter returns how long a go test process may run before it is killed,
+// 0 for no limit: Timeout when set along with GoTestTimeout, otherwise a
+// grace period past the -timeout given to go test.
+func (r *runner) killAfter() time.Duration {
+	if r.opts.GoTestTimeout > 0 && r.opts.Timeout > 0 {
+		return r.opts.Timeout
+	}
+
+	if timeout := r.goTestTimeout(); timeout > 0 {
+		return timeout + killGrace
+	}
+
+	return 0
+}
+
+// writeCobertura writes blocks to the Cobertura file, with file names
+// relative to the module root or GOPATH directory they are found in.
+func (r *runner) writeCobertura(blocks []block) error {
+	if err := createParent(r.coberturaPath); err != nil {
+		return err
+	}
+
+	f, err := os.Create(r.coberturaPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeCobertura(f, blocks, r.sourceFile())
+}
+
+// writeLcov writes blocks to the lcov file.
+func (r *runner) writeLcov(blocks []block) error {
+	if err := createParent(r.lcovPath); err != nil {
+		return err
+	}
+
+	f, err := os.Create(r.lcovPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeLcov(f, blocks, r.sourceFile())
+}
+
+// createParent creates the directory of the file at path, and any of its
+// parents, when missing.
+func createParent(path string) error {
+	return os.MkdirAll(filepath.Dir(path), 0755)
+}
+
+// replaceOutput replaces the content of the .partial file f the profile was
+// streamed to with the profile of blocks, closes it and renames it to the
+// output path.
+func (r *runner) replaceOutput(f *os.File, blocks []block) error {
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := r.writeProfile(f, blocks); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), r.outputPath)
+}
+
+// sourceFile returns the sourceFile of the run, which finds files in the
+// module root or GOPATH src directory of their import path.
+func (r *runner) sourceFile() sourceFile {
+	gopathSrc := filepath.Join(GoPath(), "src")
+
+	return func(file string) (string, string) {
+		// the innermost module, a nested module's path is often below that
+		// of the module containing it
+		var mod project
+		for _, p := range append(append([]project(nil), r.projects...), r.nested...) {
+			if len(p.modulePath) > len(mod.modulePath) && strings.HasPrefix(file, p.modulePath+"/") {
+				mod = p
+			}
+		}
+
+		if len(mod.modulePath) > 0 {
+			return mod.moduleRoot, strings.TrimPrefix(file, mod.modulePath+"/")
+		}
+
+		return gopathSrc, file
+	}
+}
+
+// postCoveralls posts blocks to Coveralls, with file names relative to the
+// git repository of the first project.
+func (r *runner) postCoveralls(blocks []block) error {
+	dir := r.projects[0].path
+
+	files, err := coverallsSourceFiles(blocks, r.sourceFile(), gitRoot(dir))
+	if err != nil {
+		return err
+	}
+
+	return postCoveralls(coverallsJob{
+		RepoToken:   r.opts.CoverallsToken,
+		ServiceName: "overalls",
+		RunAt:       time.Now().Format(time.RFC3339),
+		Git:         gitHead(dir),
+		SourceFiles: files,
+	})
+}
 
-var (
-	modeRegex   = regexp.MustCompile("mode: [a-z]+\n")
-	gopath      = filepath.Clean(os.Getenv("GOPATH"))
-	srcPath     = gopath + SEPARATOR + "src" + SEPARATOR
-	projectPath string
-	ignoreFlag  string
-	projectFlag string
-	coverFlag   string
-	helpFlag    bool
-	debugFlag   bool
-	emptyStruct struct{}
-	ignores     = map[string]struct{}{}
-)
+// writeProfile writes the coverprofile of blocks to w, with the
+// PrefixReplace applied, a block at a time rather than building it up.
+func (r *runner) writeProfile(w io.Writer, blocks []block) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("mode: " + r.opts.OutputMode + "\n")
 
-func init() {
-	flag.StringVar(&projectFlag, "project", "", "-project [path]: relative to the '$GOPATH/src' directory")
-	flag.StringVar(&coverFlag, "covermode", "count", "Mode to run when testing files")
-	flag.StringVar(&ignoreFlag, "ignore", defaultIgnores, "-ignore [dir1,dir2...]: comma separated list of directory names to ignore")
-	flag.BoolVar(&debugFlag, "debug", false, "-debug [true|false]")
-	flag.BoolVar(&helpFlag, "help", false, "-help")
+	for _, b := range blocks {
+		b.key = r.replaceKey(b.key)
+		if err := writeBlock(bw, b); err != nil {
+			return err
+		}
+	}
 
-	// Verbose logging with file name and line number
-	log.SetFlags(log.Lshortfile)
+	return bw.Flush()
 }
-func main() {
-	logger := log.New(os.Stdout, "", log.LstdFlags)
-	runMain(logger)
+
+// writeHTML writes the coverprofile of blocks as an HTML report using go
+// tool cover, from the first project's directory so it finds the source
+// files.
+func (r *runner) writeHTML(blocks []block) error {
+	profile := r.outputPath
+
+	// go tool cover only reads a profile from a file
+	if profile == "-" {
+		f, err := ioutil.TempFile("", "overalls")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+
+		err = r.writeProfile(f, blocks)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+
+		profile = f.Name()
+	}
+
+	if err := createParent(r.htmlPath); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(r.opts.GoCmd, "tool", "cover", "-html="+profile, "-o", r.htmlPath)
+	cmd.Dir = r.projects[0].path
+
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s\n%s", err, bytes.TrimSpace(b))
+	}
+
+	return nil
 }
 
-func help() {
-	fmt.Printf(helpString)
+// replacePrefix returns blocks with the PrefixReplace applied to their file
+// paths, blocks itself when there is none.
+func (r *runner) replacePrefix(blocks []block) []block {
+	if len(r.prefixOld) == 0 {
+		return blocks
+	}
+
+	replaced := make([]block, len(blocks))
+	for i, b := range blocks {
+		b.key = r.replaceKey(b.key)
+		replaced[i] = b
+	}
+
+	return replaced
 }
 
-func parseFlags() {
-	flag.Parse()
+// replaceKey returns the block key with the PrefixReplace applied.
+func (r *runner) replaceKey(key string) string {
+	if len(r.prefixOld) > 0 && strings.HasPrefix(key, r.prefixOld) {
+		return r.prefixNew + strings.TrimPrefix(key, r.prefixOld)
+	}
+
+	return key
+}
 
-	if helpFlag {
-		help()
-		os.Exit(0)
+// readMerge reads the coverprofile to merge into the output, which must
+// have been generated with the same covermode.
+func (r *runner) readMerge() ([]byte, error) {
+	b, err := ioutil.ReadFile(r.mergePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading '%s'\n%s", r.mergePath, err)
 	}
 
-	if debugFlag {
-		fmt.Println("GOPATH:", gopath)
+	if !modeRegex.Match(b) {
+		return nil, fmt.Errorf("invalid merge profile '%s', missing mode line", r.mergePath)
 	}
 
-	if len(gopath) == 0 || gopath == "." {
-		fmt.Printf("\n**invalid GOPATH '%s'\n", gopath)
-		os.Exit(1)
+	if err := checkMode(r.opts.CoverMode, b); err != nil {
+		return nil, fmt.Errorf("invalid merge profile '%s', %s", r.mergePath, err)
 	}
 
-	fmt.Println("|", projectFlag)
-	projectFlag = filepath.Clean(projectFlag)
+	return b, nil
+}
 
-	if debugFlag {
-		fmt.Println("Project Path:", projectFlag)
+// skipped logs why the directory rel is not tested, always during a dry run
+// and otherwise only when debugging.
+func (r *runner) skipped(format string, rel string) {
+	if r.opts.Debug || r.opts.DryRun {
+		r.logger.Printf(format, rel)
 	}
+}
+
+// walk traverses the directory of the project p calling fn, in walk order,
+// for each directory with go test files that is neither ignored nor excluded
+// by the includes. fullPath is the directory's absolute path and relPath its
+// path relative to the directory of mod.
+//
+// In module mode a directory below p with its own go.mod is the root of
+// another module, which go test only finds from within it, so mod is the
+// innermost module containing the directory, p itself outside of any nested
+// module. Ignores and includes are still matched relative to p.
+func (r *runner) walk(p project, fn func(mod project, fullPath, relPath string) error) error {
+	var gitignored gitignore
+
+	// a stack of the modules containing the current directory, filepath.Walk
+	// finishes each directory before moving to the next
+	mods := []project{p}
+
+	walker := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if r.ctx.Err() != nil {
+			return r.ctx.Err()
+		}
+
+		// the project directory itself is followed, being passed with a
+		// trailing separator, but like go test ./... no symlink below it is
+		if !info.IsDir() {
+			if info.Mode()&os.ModeSymlink != 0 {
+				if target, err := os.Stat(path); err == nil && target.IsDir() {
+					r.logger.Printf("WARNING: DIR %s is a symlink to a directory, not followed as go would not, skipping\n", walkRel(p.path, path))
+				}
+			}
+			return nil
+		}
+
+		rel := walkRel(p.path, path)
+
+		if r.opts.Debug {
+			r.logger.Println("REL:", rel)
+		}
+
+		if r.ignores.match(rel) {
+			r.skipped("DIR %s ignored, skipping\n", rel)
+			return filepath.SkipDir
+		}
+
+		if r.opts.MaxDepth > 0 && len(rel) > 0 && strings.Count(rel, separator)+1 > r.opts.MaxDepth {
+			r.skipped("DIR %s below max-depth, skipping\n", rel)
+			return filepath.SkipDir
+		}
+
+		// as go test ./... would, though a project directory named so is
+		// still walked
+		if len(rel) > 0 && goIgnored(info.Name()) {
+			r.skipped("DIR %s ignored by go, skipping\n", rel)
+			return filepath.SkipDir
+		}
+
+		if len(rel) > 0 && info.Name() == "vendor" && !r.opts.IncludeVendor {
+			r.skipped("DIR %s vendored, skipping\n", rel)
+			return filepath.SkipDir
+		}
+
+		if r.opts.UseGitignore {
+			if len(rel) > 0 && gitignored.match(rel) {
+				r.skipped("DIR %s ignored by .gitignore, skipping\n", rel)
+				return filepath.SkipDir
+			}
+
+			gitignored.load(path, rel)
+		}
+
+		dir := filepath.Clean(path) + separator
+		for len(mods) > 1 && !strings.HasPrefix(dir, mods[len(mods)-1].path) {
+			mods = mods[:len(mods)-1]
+		}
+
+		if len(p.moduleRoot) > 0 && len(rel) > 0 {
+			if modPath := modulePath(path); len(modPath) > 0 {
+				if r.opts.Debug {
+					r.logger.Println("Module:", modPath, "in", path)
+				}
+
+				mod := project{path: dir, pkgPath: modPath, moduleRoot: filepath.Clean(path), modulePath: modPath}
+				mods = append(mods, mod)
+				r.nested = append(r.nested, mod)
+			}
+		}
+
+		tests, sources, subdirs, err := dirContents(path)
+		if err != nil {
+			return fmt.Errorf("error checking for test files in '%s'\n%s", relName(rel), err)
+		}
+
+		// once done with the directory there is nothing below it to walk
+		var next error
+		if !subdirs {
+			next = filepath.SkipDir
+		}
+
+		// keep walking, a directory below may still be included
+		if len(r.includes) > 0 && !r.includes.match(rel) {
+			r.skipped("DIR %s not included, skipping\n", relName(rel))
+			return next
+		}
 
-	if len(projectFlag) == 0 || projectFlag == "." {
-		fmt.Printf("\n**invalid project path '%s'\n", projectFlag)
-		help()
-		os.Exit(1)
+		if p.changed != nil && !p.changed[rel] {
+			r.skipped("DIR %s not changed, skipping\n", relName(rel))
+			return next
+		}
+
+		mod := mods[len(mods)-1]
+		relPath := strings.TrimSuffix(strings.TrimPrefix(dir, mod.path), separator)
+		tags := r.tagsFor(relPath)
+
+		if !tests {
+			r.skipped("No Go test files in %s, skipping\n", relName(rel))
+
+			if sources && hasSources(path, tags) {
+				r.untested = append(r.untested, mod.importPath(relPath))
+			}
+
+			return next
+		}
+
+		if !hasTests(path, tags) {
+			r.skipped("No Go test files matching build constraints in %s, skipping\n", relName(rel))
+			return next
+		}
+
+		if r.opts.SkipIncompatible && r.incompatible(mod, path, tags) {
+			r.skipped("DIR %s excluded by build constraints, skipping\n", relName(rel))
+			return next
+		}
+
+		if err := fn(mod, path, relPath); err != nil {
+			return err
+		}
+
+		return next
 	}
 
-	switch coverFlag {
-	case "set", "count", "atomic":
-	default:
-		fmt.Printf("\n**invalid covermode '%s'\n", coverFlag)
-		os.Exit(1)
+	return filepath.Walk(p.path, walker)
+}
+
+// walkRel returns the directory path relative to the project directory
+// root, empty for root itself, whether either ends with a separator or not.
+func walkRel(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
 	}
 
-	arr := strings.Split(ignoreFlag, ",")
-	for _, v := range arr {
-		ignores[v] = emptyStruct
+	if rel == "." {
+		return ""
 	}
+
+	return rel
 }
 
-func runMain(logger *log.Logger) {
-	parseFlags()
+// relName returns the relative directory rel as logged, "." for the project
+// directory itself.
+func relName(rel string) string {
+	if len(rel) == 0 {
+		return "."
+	}
 
-	var err error
-	var wd string
+	return rel
+}
 
-	projectPath = srcPath + projectFlag + SEPARATOR
+// goIgnored reports whether go ignores the directory name for package
+// patterns such as ./...: testdata and names starting with '.' or '_'.
+func goIgnored(name string) bool {
+	return name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
 
-	if err = os.Chdir(projectPath); err != nil {
-		logger.Printf("\n**invalid project path '%s'\n%s\n", projectFlag, err)
-		help()
-		os.Exit(1)
+// dirContents reports whether dir holds any go test files, other go files
+// and subdirectories, reading its entries once rather than globbing, which
+// is much cheaper for the many directories of large non-Go trees.
+func dirContents(dir string) (tests, sources, subdirs bool, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, false, false, err
 	}
 
-	if debugFlag {
-		wd, err = os.Getwd()
-		if err != nil {
-			fmt.Println(err)
+	for _, e := range entries {
+		switch {
+		case e.IsDir():
+			subdirs = true
+		case strings.HasSuffix(e.Name(), "_test.go"):
+			tests = true
+		case strings.HasSuffix(e.Name(), ".go"):
+			sources = true
 		}
 
-		logger.Println("Working DIR:", wd)
+		if tests && sources && subdirs {
+			break
+		}
 	}
 
-	testFiles(logger)
+	return tests, sources, subdirs, nil
 }
 
-func scanOutput(r io.ReadCloser, fn func(...interface{})) {
-	defer r.Close()
-	bs := bufio.NewScanner(r)
-	for bs.Scan() {
-		fn(bs.Text())
-	}
-	if err := bs.Err(); err != nil {
-		fn(fmt.Sprintf("Scan error: %v", err.Error()))
+// tagsRule is an entry of Options.TagsMap.
+type tagsRule struct {
+	patterns patterns
+	tags     string
+}
+
+// tagsFor returns the build tags of the package at rel, relative to its
+// project or nested module: those of the first Options.TagsMap entry
+// matching it, or Options.Tags.
+func (r *runner) tagsFor(rel string) string {
+	for _, rule := range r.tagsMap {
+		if rule.patterns.match(rel) {
+			return rule.tags
+		}
 	}
+
+	return r.opts.Tags
 }
 
-func processDIR(logger *log.Logger, wg *sync.WaitGroup, fullPath, relPath string, out chan<- []byte) {
-	defer wg.Done()
+// minimumRule is an entry of Options.PackageMinimums.
+type minimumRule struct {
+	patterns patterns
+	min      float64
+}
 
-	// 1 for "test", 4 for coermode, coverprofile, outputdir, relpath
-	args := make([]string, 1, 1+len(flag.Args())+4)
-	args[0] = "test"
-	args = append(args, flag.Args()...)
-	args = append(args, "-covermode="+coverFlag, "-coverprofile="+pkgFilename, "-outputdir="+fullPath+SEPARATOR, projectFlag+SEPARATOR+relPath)
-	//fmt.Printf("Test args: %+v\n", args)
-	fmt.Printf("Test package: %v\n", projectFlag+SEPARATOR+relPath)
+// CheckPackageMinimum returns the error Run gives for the
+// Options.PackageMinimums entry, letting callers check it before any other
+// option.
+func CheckPackageMinimum(entry string) error {
+	_, err := parseMinimum(entry)
+	return err
+}
 
-	cmd := exec.Command("go", args...)
+// parseMinimum parses the Options.PackageMinimums entry.
+func parseMinimum(entry string) (minimumRule, error) {
+	i := strings.LastIndex(entry, "=")
+	if i < 1 {
+		return minimumRule{}, fmt.Errorf("invalid package-min '%s', must be pattern=percent", entry)
+	}
 
-	if debugFlag {
-		logger.Println("Processing:", strings.Join(cmd.Args, " "))
+	minimum, err := strconv.ParseFloat(entry[i+1:], 64)
+	if err != nil || minimum < 0 || minimum > 100 {
+		return minimumRule{}, fmt.Errorf("invalid package-min '%s', percent must be between 0 and 100", entry)
 	}
-	stdout, err := cmd.StdoutPipe()
+
+	ps, err := newPatterns([]string{entry[:i]})
 	if err != nil {
-		logger.Fatal("Unable to get process stdout")
+		return minimumRule{}, fmt.Errorf("invalid package-min: %s", err)
+	}
+
+	return minimumRule{patterns: ps, min: minimum}, nil
+}
+
+// belowMinimum returns the packages of summary whose coverage is below the
+// minimum of the first Options.PackageMinimums entry matching them, or
+// Options.FailUnder for those matching none, nil without any entry.
+func (r *runner) belowMinimum(summary []PackageCoverage) []PackageMinimum {
+	if len(r.minimums) == 0 {
+		return nil
+	}
+
+	var below []PackageMinimum
+
+	for _, p := range summary {
+		minimum := r.opts.FailUnder
+		for _, rule := range r.minimums {
+			if rule.patterns.match(p.Package) {
+				minimum = rule.min
+				break
+			}
+		}
+
+		if p.Coverage < minimum {
+			below = append(below, PackageMinimum{Package: p.Package, Coverage: p.Coverage, Minimum: minimum})
+		}
+	}
+
+	return below
+}
+
+// buildContext returns the build context for the current platform and the
+// comma or space separated build tags.
+func buildContext(tags string) build.Context {
+	ctx := build.Default
+	ctx.BuildTags = strings.FieldsFunc(tags, func(c rune) bool { return c == ',' || c == ' ' })
+
+	return ctx
+}
+
+// hasTests reports whether any of the test files in dir are included by the
+// build constraints for the current platform and tags. It reports
+// true when this can't be determined, leaving go test to report the error.
+func hasTests(dir, tags string) bool {
+	ctx := buildContext(tags)
+
+	pkg, err := ctx.ImportDir(dir, 0)
+	if _, ok := err.(*build.NoGoError); ok {
+		return false
 	}
-	go scanOutput(stdout, logger.Print)
 
-	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		logger.Fatal("Unable to get process stderr")
+		return true
+	}
+
+	return len(pkg.TestGoFiles)+len(pkg.XTestGoFiles) > 0
+}
+
+// hasSources reports whether dir holds a package under the build tags,
+// at least one of its go files matching the build constraints.
+func hasSources(dir, tags string) bool {
+	ctx := buildContext(tags)
+
+	_, err := ctx.ImportDir(dir, 0)
+	_, noGo := err.(*build.NoGoError)
+
+	return !noGo
+}
+
+// incompatible reports whether go, with the environment and build tags go
+// test is run with, finds none of the files of the package in dir of p
+// included by the build constraints, as for a package of another platform.
+// It reports false when go can't tell, leaving go test to report the error.
+func (r *runner) incompatible(p project, dir, tags string) bool {
+	args := []string{"list", "-e", "-f", "{{if .Error}}{{.Error}}{{end}}"}
+	if len(r.opts.Mod) > 0 && len(p.moduleRoot) > 0 {
+		args = append(args, "-mod="+r.opts.Mod)
+	}
+	if len(tags) > 0 {
+		args = append(args, "-tags="+tags)
 	}
-	go scanOutput(stderr, logger.Print)
+	args = append(args, ".")
 
-	if err := cmd.Run(); err != nil {
-		logger.Fatal("ERROR:", err)
+	cmd := exec.CommandContext(r.ctx, r.opts.GoCmd, args...)
+	cmd.Dir = dir
+
+	if len(r.opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), r.opts.Env...)
 	}
 
-	b, err := ioutil.ReadFile(relPath + SEPARATOR + "profile.coverprofile")
+	b, err := cmd.Output()
 	if err != nil {
-		logger.Fatal("ERROR:", err)
+		return false
 	}
 
-	out <- b
+	return constraintsRegex.Match(b)
 }
 
-func testFiles(logger *log.Logger) {
-	out := make(chan []byte)
-	wg := &sync.WaitGroup{}
+// prebuild runs go build or go vet, as Options.Prebuild, on every package
+// of each project, logging go's output when it fails.
+func (r *runner) prebuild() error {
+	for _, p := range r.projects {
+		args := []string{r.opts.Prebuild}
+		if len(r.opts.Tags) > 0 {
+			args = append(args, "-tags="+r.opts.Tags)
+		}
+		if len(r.opts.Mod) > 0 && len(p.moduleRoot) > 0 {
+			args = append(args, "-mod="+r.opts.Mod)
+		}
+		args = append(args, "./...")
 
-	walker := func(path string, info os.FileInfo, err error) error {
+		cmd := exec.CommandContext(r.ctx, r.opts.GoCmd, args...)
+		cmd.Dir = p.path
 
-		if !info.IsDir() {
-			return nil
+		if len(r.opts.Env) > 0 {
+			cmd.Env = append(os.Environ(), r.opts.Env...)
 		}
 
-		rel := strings.Replace(path, projectPath, "", 1)
+		if r.opts.Debug {
+			r.logger.Println("Prebuild:", strings.Join(cmd.Args, " "), "in", p.path)
+		}
 
-		log.Print("REL:", rel)
+		if b, err := cmd.CombinedOutput(); err != nil {
+			if r.ctx.Err() != nil {
+				return r.ctx.Err()
+			}
 
-		if _, ignore := ignores[rel]; ignore {
-			return filepath.SkipDir
+			r.logger.Printf("ERROR: %s failed in '%s': %s\n%s", strings.Join(cmd.Args, " "), p.path, err, b)
+			return ErrPrebuildFailed
 		}
+	}
+
+	return nil
+}
 
-		//rel = "." + string(os.PathSeparator) + rel
-		//rel = rel
+// moduleMode describes the module mode go is run with, for -debug.
+func (r *runner) moduleMode() string {
+	if os.Getenv("GO111MODULE") == "off" {
+		return "off, GOPATH"
+	}
 
-		if files, err := filepath.Glob(rel + SEPARATOR + "*_test.go"); len(files) == 0 || err != nil {
+	if len(r.opts.Mod) > 0 {
+		return "-mod=" + r.opts.Mod
+	}
 
-			if err != nil {
-				logger.Printf("Error checking for test files")
-				os.Exit(1)
-			}
+	// the last one wins, as it does for go
+	mode := "go's default"
+	for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if strings.HasPrefix(f, "--") {
+			f = f[1:]
+		}
 
-			if debugFlag {
-				logger.Printf("No Go Test files in DIR:", rel, "skipping")
-			}
+		if strings.HasPrefix(f, "-mod=") {
+			mode = f + " from GOFLAGS"
+		}
+	}
 
+	return mode
+}
+
+// dryRun reports the packages that would be tested without testing them.
+func (r *runner) dryRun() (Result, error) {
+	var res Result
+
+	for _, p := range r.projects {
+		err := r.walk(p, func(mod project, fullPath, relPath string) error {
+			pkg := mod.importPath(relPath)
+			r.logger.Printf("Would test: %s\n", pkg)
+			res.Packages = append(res.Packages, PackageResult{ImportPath: pkg})
 			return nil
+		})
+		if err != nil && err != r.ctx.Err() {
+			return res, fmt.Errorf("could not walk project path '%s'\n%s", p.path, err)
 		}
+	}
 
-		wg.Add(1)
-		go processDIR(logger, wg, path, rel, out)
+	res.Untested = r.untested
 
-		return nil
+	return res, r.ctx.Err()
+}
+
+func (r *runner) testFiles() (Result, error) {
+	var merge []byte
+	if len(r.mergePath) > 0 {
+		var err error
+		if merge, err = r.readMerge(); err != nil {
+			return Result{}, err
+		}
 	}
 
-	if err := filepath.Walk(projectPath, walker); err != nil {
-		logger.Fatalf("\n**could not walk project path '%s'\n%s\n", projectPath, err)
+	// read up front so a missing baseline fails before testing
+	var baseline []block
+	if len(r.baselinePath) > 0 {
+		var err error
+		if baseline, err = r.readBaseline(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if len(r.opts.Prebuild) > 0 {
+		if err := r.prebuild(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	m := newMerger(r.opts.CoverMode)
+	m.add(excludeBlocks(parseBlocks(string(merge)), r.excludes))
+
+	// write each profile out as it arrives so a run that dies part way
+	// still leaves the coverage collected so far in the .partial file, the
+	// merged and sorted profile replacing it and renamed to the output once
+	// every package is done. Only the merged blocks are kept in memory, not
+	// each package's profile or the whole output.
+	var stream *os.File
+	if r.outputPath != "-" {
+		if err := createParent(r.outputPath); err != nil {
+			return Result{}, fmt.Errorf("error writing '%s'\n%s", r.outputPath, err)
+		}
+
+		f, err := ioutil.TempFile(filepath.Dir(r.outputPath), filepath.Base(r.outputPath)+".*"+partialSuffix)
+		if err != nil {
+			return Result{}, fmt.Errorf("error writing '%s'\n%s", r.outputPath, err)
+		}
+		defer os.Remove(f.Name())
+
+		// as readable as a file written with ioutil.WriteFile
+		if err := f.Chmod(0644); err != nil {
+			f.Close()
+			return Result{}, fmt.Errorf("error writing '%s'\n%s", r.outputPath, err)
+		}
+
+		stream = f
+		r.writeProfile(stream, m.blocks)
 	}
 
+	out := make(chan []byte)
+	sem := make(chan struct{}, r.opts.Concurrency)
+	wg := &sync.WaitGroup{}
+
+	var walkErr error
+	var walkPath string
+
+	// walked in its own goroutine so each profile is merged and streamed
+	// as its package finishes, rather than waiting in processDIR, whole,
+	// until the walk has started the last package
+	walked := make(chan struct{})
+
 	go func() {
+		for _, p := range r.projects {
+			walkErr = r.walk(p, func(mod project, fullPath, relPath string) error {
+				// acquire in walk order so a Concurrency of 1 is fully serial
+				select {
+				case sem <- emptyStruct:
+				case <-r.ctx.Done():
+					return r.ctx.Err()
+				}
+
+				// both may have been ready, don't start a package once done
+				if err := r.ctx.Err(); err != nil {
+					<-sem
+					return err
+				}
+
+				wg.Add(1)
+				go r.processDIR(wg, sem, mod, fullPath, relPath, out)
+
+				return nil
+			})
+			if walkErr != nil {
+				walkPath = p.path
+				break
+			}
+		}
+		close(walked)
+
+		// every processDIR is done with wg whether it sent a profile or not
 		wg.Wait()
 		close(out)
 	}()
 
-	buff := bytes.NewBufferString("")
+	var grace <-chan time.Time
+	done := r.ctx.Done()
+
+collect:
+	for {
+		select {
+		case cover, ok := <-out:
+			if !ok {
+				break collect
+			}
+			blocks := excludeBlocks(parseBlocks(string(cover)), r.excludes)
+			m.add(blocks)
+			if stream != nil {
+				io.WriteString(stream, formatBlocks(r.replacePrefix(blocks)))
+			}
+		case <-done:
+			done = nil
+			grace = time.After(drainGrace)
+		case <-grace:
+			r.logger.Printf("WARNING: packages still running %s after cancel, writing collected coverage\n", drainGrace)
+
+			// keep draining so the remaining processDIR goroutines can exit
+			go func() {
+				for range out {
+				}
+			}()
+			break collect
+		}
+	}
+
+	// the walk stops starting packages once canceled, so this is soon
+	<-walked
+
+	res := Result{Output: r.outputPath, Packages: r.results.sorted(), Untested: r.untested}
+
+	if len(r.carried) > 0 {
+		m.add(carryOver(r.carried, res.Packages))
+	}
+
+	if walkErr != nil && walkErr != r.ctx.Err() {
+		// merged and sorted as on success, what was streamed may repeat
+		// blocks, as it does with CoverPkg
+		if stream != nil {
+			if err := r.replaceOutput(stream, m.sorted()); err != nil {
+				r.logger.Printf("ERROR: unable to write '%s'\n%s\n", r.outputPath, err)
+			}
+		}
+		return res, fmt.Errorf("could not walk project path '%s'\n%s", walkPath, walkErr)
+	}
+
+	// sorted rather than in the order packages finished, so unchanged code
+	// gives a byte for byte identical profile, written out a block at a
+	// time so the profile is never held whole on top of the blocks
+	blocks := m.sorted()
+	r.blocks = blocks
 
-	for cover := range out {
-		buff.Write(cover)
+	if r.outputPath == "-" {
+		if err := r.writeProfile(r.opts.Stdout, blocks); err != nil {
+			return res, fmt.Errorf("error writing to stdout\n%s", err)
+		}
+	} else if err := r.replaceOutput(stream, blocks); err != nil {
+		return res, fmt.Errorf("error writing '%s'\n%s", r.outputPath, err)
+	}
+
+	if len(r.coberturaPath) > 0 {
+		if err := r.writeCobertura(blocks); err != nil {
+			return res, fmt.Errorf("error writing '%s'\n%s", r.coberturaPath, err)
+		}
+	}
+
+	if len(r.lcovPath) > 0 {
+		if err := r.writeLcov(blocks); err != nil {
+			return res, fmt.Errorf("error writing '%s'\n%s", r.lcovPath, err)
+		}
+	}
+
+	if len(r.opts.CoverallsToken) > 0 {
+		if err := r.postCoveralls(blocks); err != nil {
+			return res, fmt.Errorf("error posting to Coveralls\n%s", err)
+		}
+	}
+
+	if len(r.htmlPath) > 0 {
+		if err := r.writeHTML(blocks); err != nil {
+			r.logger.Printf("ERROR: unable to write HTML report '%s'\n%s\n", r.htmlPath, err)
+		}
+	}
+
+	res.Coverage = percentCovered(blocks)
+	res.Summary = packageCoverage(blocks)
+	res.BelowMinimum = r.belowMinimum(res.Summary)
+
+	if len(r.baselinePath) > 0 {
+		// compared by the names written, the files found by those go gave
+		source := r.sourceFile()
+		res.Delta = newDelta(r.replacePrefix(blocks), baseline, func(file string) (string, string) {
+			if len(r.prefixOld) > 0 && strings.HasPrefix(file, r.prefixNew) {
+				file = r.prefixOld + strings.TrimPrefix(file, r.prefixNew)
+			}
+			return source(file)
+		})
+	}
+
+	if r.opts.FailUnder > 0 {
+		r.logger.Printf("Total coverage: %.1f%% of statements, minimum %.1f%%\n", res.Coverage, r.opts.FailUnder)
+	}
+
+	// stopped by FailFast or MaxFailures is reported as the failure it was
+	if err := r.parent.Err(); err != nil {
+		return res, err
+	}
+
+	if len(res.Packages) == 0 && !r.opts.AllowEmpty {
+		r.logger.Println("WARNING: no packages were tested")
+		return res, ErrNoPackages
+	}
+
+	for _, p := range res.Failed() {
+		if !p.BuildFailed || !r.opts.AllowBuildFailures {
+			return res, ErrPackagesFailed
+		}
+	}
+
+	if r.opts.RequireTests && len(res.Untested) > 0 {
+		return res, ErrUntestedPackages
 	}
 
-	final := buff.String()
-	final = modeRegex.ReplaceAllString(final, "")
-	final = "mode: " + coverFlag + "\n" + final
+	if res.Coverage < r.opts.FailUnder {
+		return res, ErrCoverageTooLow
+	}
+
+	if len(res.BelowMinimum) > 0 {
+		return res, ErrPackageCoverageTooLow
+	}
 
-	if err := ioutil.WriteFile(outFilename, []byte(final), 0644); err != nil {
-		logger.Fatal("ERROR Writing \""+outFilename+"\"", err)
+	if r.opts.FailOnDecrease && res.Delta.Change < 0 {
+		return res, ErrCoverageDecreased
 	}
+
+	return res, nil
 }
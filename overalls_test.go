@@ -1,12 +1,22 @@
-package main
+package overalls
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	. "gopkg.in/go-playground/assert.v1"
 )
@@ -22,7 +32,11 @@ import (
 // go test -coverprofile cover.out && go tool cover -html=cover.out -o cover.html
 //
 
+var srcPath = filepath.Clean(os.Getenv("GOPATH")) + "/src/"
+
 func TestOveralls_Default(t *testing.T) {
+	defer cleanFixtures()
+
 	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
 		final := string(fileBytes)
 		NotEqual(t, strings.Index(final, "main.go"), -1)
@@ -32,38 +46,1773 @@ func TestOveralls_Default(t *testing.T) {
 		MatchRegex(t, string(output), "-outputdir=.*/go-playground/overalls/test-files/good")
 
 		MatchRegex(t, string(output), "go test -covermode=count")
+		MatchRegex(t, string(output), "No Go test files in no-test-files, skipping\n")
 	})
 }
 
 func TestOveralls_WithExtraArguments(t *testing.T) {
+	defer cleanFixtures()
+
 	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
 		MatchRegex(t, string(output), "Processing: go test")
 
 		MatchRegex(t, string(output), "=== RUN")
 		MatchRegex(t, string(output), "--- PASS: TestGood")
-	}, "--", "-v")
+	}, func(opts *Options) { opts.TestArgs = []string{"-v"} })
+}
+
+func TestOveralls_Verbose(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "Processing: go test -v -covermode=count")
+		MatchRegex(t, string(output), "\n=== RUN   TestGood\n")
+		MatchRegex(t, string(output), "\n--- PASS: TestGood")
+	}, func(opts *Options) { opts.Verbose = true })
+}
+
+func TestOveralls_Quiet(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		Equal(t, strings.Index(string(output), "Test package:"), -1)
+		Equal(t, strings.Index(string(output), "=== RUN"), -1)
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) {
+		opts.Quiet = true
+		opts.Debug = false
+		opts.TestArgs = []string{"-v"}
+	})
 }
 
-func withTestingOveralls(t *testing.T, fn func(output []byte, coverage []byte), args ...string) {
-	baseArgs := []string{"-project=github.com/go-playground/overalls/test-files", "-covermode=count", "-debug"}
-	args = append(baseArgs, args...)
-	args = append([]string{"overalls"}, args...)
-	defer stubArgs(args...)()
+func TestOveralls_QuietGo(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "Test package: github.com/go-playground/overalls/test-files/good\n")
+		Equal(t, strings.Index(string(output), "=== RUN"), -1)
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) {
+		opts.QuietGo = true
+		opts.Debug = false
+		opts.TestArgs = []string{"-v"}
+	})
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	oldEnv := os.Getenv("OVERALLS_FLAKY_MARKER")
+	os.Setenv("OVERALLS_FLAKY_MARKER", filepath.Join(dir, "marker"))
+	defer os.Setenv("OVERALLS_FLAKY_MARKER", oldEnv)
 
+	// the output of the failing package only, all of it
 	out := &bytes.Buffer{}
-	runMain(log.New(out, "", 0))
 
-	fileBytes, err := ioutil.ReadFile(srcPath + "github.com/go-playground/overalls/test-files/overalls.coverprofile")
+	_, err = Run(Options{
+		Project:  "github.com/go-playground/overalls/test-files",
+		Includes: []string{"flaky", "good"},
+		Tags:     "flaky",
+		TestArgs: []string{"-v"},
+		QuietGo:  true,
+		Logger:   log.New(out, "", 0),
+	})
+	Equal(t, err, ErrPackagesFailed)
+	MatchRegex(t, out.String(), "=== RUN   TestFlaky\n(.|\n)*first attempt\n(.|\n)*FAIL\tgithub.com/go-playground/overalls/test-files/flaky")
+	Equal(t, strings.Index(out.String(), "=== RUN   TestGood"), -1)
+}
 
-	// Ensure no error reading file
+func TestOveralls_WithConcurrency(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		NotEqual(t, strings.Index(final, "test-files/good/main.go"), -1)
+		NotEqual(t, strings.Index(final, "test-files/good2/main.go"), -1)
+	}, func(opts *Options) { opts.Concurrency = 1 })
+}
+
+func TestOveralls_WithTimeout(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "go test -timeout=1m0s")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) { opts.Timeout = time.Minute })
+}
+
+func TestOveralls_WithGoTestTimeout(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "go test -timeout=30s")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) {
+		opts.GoTestTimeout = 30 * time.Second
+		opts.Timeout = time.Hour
+	})
+
+	tests := []struct {
+		timeout, goTest time.Duration
+		args, kill      time.Duration
+	}{
+		{},
+		{timeout: time.Minute, args: time.Minute, kill: time.Minute + killGrace},
+		{goTest: time.Minute, args: time.Minute, kill: time.Minute + killGrace},
+		{timeout: time.Hour, goTest: time.Minute, args: time.Minute, kill: time.Hour},
+	}
+
+	for _, tt := range tests {
+		r := &runner{opts: Options{Timeout: tt.timeout, GoTestTimeout: tt.goTest}}
+		Equal(t, r.goTestTimeout(), tt.args)
+		Equal(t, r.killAfter(), tt.kill)
+	}
+
+	_, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", GoTestTimeout: -time.Second})
+	Equal(t, err.Error(), "invalid go-test-timeout '-1s', must not be negative")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", GoTestTimeout: time.Minute, Timeout: time.Minute})
+	Equal(t, err.Error(), "invalid timeout '1m0s', must be longer than go-test-timeout '1m0s'")
+}
+
+func TestOveralls_Deterministic(t *testing.T) {
+	defer cleanFixtures()
+
+	var profiles [2][]byte
+
+	for i := range profiles {
+		withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+			profiles[i] = fileBytes
+		}, func(opts *Options) { opts.Concurrency = 3 })
+	}
+
+	NotEqual(t, len(profiles[0]), 0)
+	Equal(t, string(profiles[0]), string(profiles[1]))
+	Equal(t, strings.Index(string(profiles[0]), "test-files/good/main.go") < strings.Index(string(profiles[0]), "test-files/good2/main.go"), true)
+}
+
+func TestOveralls_WithOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overalls")
 	Equal(t, err, nil)
-	fn(out.Bytes(), fileBytes)
+	defer os.RemoveAll(dir)
+
+	// missing directories are created
+	output := dir + "/reports/coverage/all.coverprofile"
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", Output: output})
+	Equal(t, err, nil)
+	Equal(t, res.Output, output)
+
+	fileBytes, err := ioutil.ReadFile(output)
+	Equal(t, err, nil)
+	NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+
+	// renamed into place from a temporary file, an existing one replaced
+	err = ioutil.WriteFile(output, []byte("old"), 0644)
+	Equal(t, err, nil)
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Output: output, Includes: []string{"good"}})
+	Equal(t, err, nil)
+
+	fileBytes, err = ioutil.ReadFile(output)
+	Equal(t, err, nil)
+	MatchRegex(t, string(fileBytes), "^mode: count\n.*test-files/good/main.go")
+
+	info, err := os.Stat(output)
+	Equal(t, err, nil)
+	if runtime.GOOS != "windows" {
+		Equal(t, info.Mode().Perm(), os.FileMode(0644))
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Dir(output))
+	Equal(t, err, nil)
+	Equal(t, len(entries), 1)
+
+	// the .partial file of another run sharing the output is left alone,
+	// and a run canceled part way leaves nothing but the output
+	other := output + ".other.partial"
+	err = ioutil.WriteFile(other, []byte("mode: count\nkilled"), 0644)
+	Equal(t, err, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = RunContext(ctx, Options{Project: "github.com/go-playground/overalls/test-files", Output: output, OnEvent: func(e Event) {
+		if e.Type == EventStart {
+			cancel()
+		}
+	}})
+	Equal(t, err, context.Canceled)
+
+	entries, err = ioutil.ReadDir(filepath.Dir(output))
+	Equal(t, err, nil)
+	Equal(t, len(entries), 2)
+	Equal(t, entries[0].Name(), "all.coverprofile")
+	Equal(t, entries[1].Name(), filepath.Base(other))
+
+	fileBytes, err = ioutil.ReadFile(output)
+	Equal(t, err, nil)
+	MatchRegex(t, string(fileBytes), "^mode: count\n")
+	NotMatchRegex(t, string(fileBytes), "killed")
+
+	fileBytes, err = ioutil.ReadFile(other)
+	Equal(t, err, nil)
+	Equal(t, string(fileBytes), "mode: count\nkilled")
+}
+
+func TestOveralls_StreamsPartial(t *testing.T) {
+	oldEnv := os.Getenv("GO111MODULE")
+	os.Setenv("GO111MODULE", "off")
+	defer os.Setenv("GO111MODULE", oldEnv)
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	release := filepath.Join(dir, "release")
+
+	// b's test runs until released, after a's profile is seen streamed,
+	// c waiting on b's slot
+	files := map[string]string{
+		"a/a.go":      "package a\n\nfunc A() int { return 1 }\n",
+		"a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) { A() }\n",
+		"b/b.go":      "package b\n\nfunc B() int { return 2 }\n",
+		"b/b_test.go": "package b\n\nimport (\n\t\"os\"\n\t\"testing\"\n\t\"time\"\n)\n\nfunc TestB(t *testing.T) {\n\tfor i := 0; i < 600; i++ {\n\t\tif _, err := os.Stat(" + strconv.Quote(release) + "); err == nil {\n\t\t\tbreak\n\t\t}\n\t\ttime.Sleep(100 * time.Millisecond)\n\t}\n\tB()\n}\n",
+		"c/c.go":      "package c\n\nfunc C() int { return 3 }\n",
+		"c/c_test.go": "package c\n\nimport \"testing\"\n\nfunc TestC(t *testing.T) { C() }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		Equal(t, os.MkdirAll(filepath.Dir(path), 0755), nil)
+		Equal(t, ioutil.WriteFile(path, []byte(content), 0644), nil)
+	}
+
+	output := filepath.Join(dir, "out", "all.coverprofile")
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := Run(Options{Project: dir, Output: output, Concurrency: 1, Logger: log.New(ioutil.Discard, "", 0)})
+		errs <- err
+	}()
+
+	streamed := false
+	for i := 0; i < 600 && !streamed; i++ {
+		partials, _ := filepath.Glob(output + ".*.partial")
+		for _, partial := range partials {
+			b, _ := ioutil.ReadFile(partial)
+			streamed = streamed || strings.Contains(string(b), "/a/a.go:")
+		}
+		if !streamed {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	Equal(t, ioutil.WriteFile(release, nil, 0644), nil)
+
+	Equal(t, <-errs, nil)
+	Equal(t, streamed, true)
+
+	b, err := ioutil.ReadFile(output)
+	Equal(t, err, nil)
+	MatchRegex(t, string(b), "/a/a.go:(.|\n)*/b/b.go:(.|\n)*/c/c.go:")
+}
+
+func TestOveralls_WithOutputMode(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "WARNING: output-mode 'set' differs from covermode 'count'")
+		MatchRegex(t, string(output), "go test -covermode=count ")
+		MatchRegex(t, string(fileBytes), "^mode: set\ngithub.com/go-playground/overalls/test-files/good/main.go:")
+	}, func(opts *Options) { opts.OutputMode = "set" })
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		NotMatchRegex(t, string(output), "WARNING: output-mode")
+		MatchRegex(t, string(fileBytes), "^mode: count\n")
+	}, func(opts *Options) { opts.OutputMode = "count" })
+
+	_, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", OutputMode: "bad"})
+	Equal(t, err.Error(), "invalid output-mode 'bad', must be set, count or atomic")
+}
+
+func TestOveralls_WithHTML(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	html := filepath.Join(dir, "reports", "coverage.html")
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		b, err := ioutil.ReadFile(html)
+		Equal(t, err, nil)
+		MatchRegex(t, string(b), "github.com/go-playground/overalls/test-files/good/main.go")
+	}, func(opts *Options) { opts.HTML = html })
+
+	// the coverprofile is written even when the report can't be
+	err = ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+	Equal(t, err, nil)
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "ERROR: unable to write HTML report '"+regexp.QuoteMeta(dir)+"/file/coverage.html'\n")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) { opts.HTML = filepath.Join(dir, "file", "coverage.html") })
+}
+
+func TestOveralls_WithSplitOutput(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	split := filepath.Join(dir, "split")
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		for _, pkg := range []string{"good", "good2"} {
+			b, err := ioutil.ReadFile(filepath.Join(split, "github.com", "go-playground", "overalls", "test-files", pkg+".coverprofile"))
+			Equal(t, err, nil)
+			MatchRegex(t, string(b), "^mode: count\ngithub.com/go-playground/overalls/test-files/"+pkg+"/main.go:")
+		}
+	}, func(opts *Options) { opts.SplitOutput = split })
+
+	// the run goes on without them
+	err = ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+	Equal(t, err, nil)
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "WARNING: unable to write the coverprofile of github.com/go-playground/overalls/test-files/good to '"+regexp.QuoteMeta(dir)+"/file/")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) { opts.SplitOutput = filepath.Join(dir, "file") })
+}
+
+func TestOveralls_PrefixReplace(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		Equal(t, strings.Index(final, "github.com/"), -1)
+		NotEqual(t, strings.Index(final, "\n/src/overalls/test-files/good/main.go:"), -1)
+		NotEqual(t, strings.Index(final, "\n/src/overalls/test-files/good2/main.go:"), -1)
+	}, func(opts *Options) { opts.PrefixReplace = "github.com/go-playground/=/src/" })
 }
 
-func stubArgs(args ...string) func() {
-	oldArgs := os.Args
-	os.Args = args
-	return func() {
-		os.Args = oldArgs
+func TestOveralls_ExternalTests(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "No Go test files matching build constraints in external, skipping\n")
+	})
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"external"}, Tags: "external"})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Packages[0].Coverage, float64(100))
+	Equal(t, res.Summary[0].Package, "github.com/go-playground/overalls/test-files/external")
+}
+
+func TestOveralls_BuildFailed(t *testing.T) {
+	defer cleanFixtures()
+
+	for _, quiet := range []bool{false, true} {
+		out := &bytes.Buffer{}
+
+		res, err := Run(Options{
+			Project:  "github.com/go-playground/overalls/test-files",
+			Includes: []string{"broken"},
+			Tags:     "broken",
+			Retries:  2,
+			Quiet:    quiet,
+			Logger:   log.New(out, "", 0),
+		})
+		Equal(t, err, ErrPackagesFailed)
+		Equal(t, len(res.Failed()), 1)
+		Equal(t, res.Packages[0].BuildFailed, true)
+		Equal(t, res.Packages[0].ExitCode, 1)
+		Equal(t, res.Packages[0].Attempts, 1)
+		MatchRegex(t, res.Packages[0].Err.Error(), "^build failed: exit status 1$")
+		NotMatchRegex(t, out.String(), "Retrying")
+	}
+}
+
+func TestOveralls_AllowBuildFailures(t *testing.T) {
+	defer cleanFixtures()
+
+	out := &bytes.Buffer{}
+
+	// broken is walked first, it must not stop the run
+	res, err := Run(Options{
+		Project:            "github.com/go-playground/overalls/test-files",
+		Includes:           []string{"broken", "good"},
+		Tags:               "broken",
+		Concurrency:        1,
+		FailFast:           true,
+		AllowBuildFailures: true,
+		Logger:             log.New(out, "", 0),
+	})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 2)
+	Equal(t, res.Packages[0].BuildFailed, true)
+	Equal(t, res.Packages[1].Err, nil)
+	Equal(t, res.Coverage, float64(100))
+	MatchRegex(t, out.String(), "WARNING: quarantining github.com/go-playground/overalls/test-files/broken build failed")
+
+	fileBytes, err := ioutil.ReadFile(res.Output)
+	Equal(t, err, nil)
+	NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+
+	os.Remove(res.Output)
+}
+
+func TestOveralls_WithEnv(t *testing.T) {
+	defer cleanFixtures()
+
+	opts := Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"env"}, Tags: "env"}
+
+	_, err := Run(opts)
+	Equal(t, err, ErrPackagesFailed)
+
+	opts.Env = []string{"OVERALLS_ENV=first", "OVERALLS_ENV=a=b"}
+	res, err := Run(opts)
+	Equal(t, err, nil)
+	Equal(t, res.Packages[0].Coverage, float64(100))
+
+	opts.Env = []string{"=a"}
+	_, err = Run(opts)
+	Equal(t, err.Error(), "invalid env '=a', must be KEY=VALUE")
+}
+
+func TestOveralls_FreshCache(t *testing.T) {
+	defer cleanFixtures()
+
+	if testing.Short() {
+		t.Skip("builds the standard library from scratch")
+	}
+
+	out := &bytes.Buffer{}
+
+	// cached by the other tests, it is replayed unless built again
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"good"}, FreshCache: true, Debug: true, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	Equal(t, res.Packages[0].Coverage, float64(100))
+	Equal(t, strings.Index(out.String(), "(cached)"), -1)
+
+	m := regexp.MustCompile("GOCACHE: (.*)\n").FindStringSubmatch(out.String())
+	NotEqual(t, m, nil)
+
+	_, err = os.Stat(m[1])
+	Equal(t, os.IsNotExist(err), true)
+}
+
+func TestOveralls_DeepPackage(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "-outputdir=.*/test-files/deep/er/est/ github.com/go-playground/overalls/test-files/deep/er/est\n")
+		NotEqual(t, strings.Index(string(fileBytes), "\ngithub.com/go-playground/overalls/test-files/deep/er/est/est.go:"), -1)
+	}, func(opts *Options) {
+		opts.Tags = "deep"
+		opts.Includes = []string{"deep/..."}
+	})
+}
+
+func TestOveralls_KeepProfiles(t *testing.T) {
+	defer cleanFixtures()
+
+	profile := srcPath + "github.com/go-playground/overalls/test-files/good/profile.coverprofile"
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		_, err := os.Stat(profile)
+		Equal(t, os.IsNotExist(err), true)
+	})
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		_, err := os.Stat(profile)
+		Equal(t, err, nil)
+	}, func(opts *Options) { opts.KeepProfiles = true })
+
+	os.Remove(profile)
+
+	named := srcPath + "github.com/go-playground/overalls/test-files/good/named.out"
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "-coverprofile=named.out ")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+
+		_, err := os.Stat(named)
+		Equal(t, err, nil)
+		_, err = os.Stat(profile)
+		Equal(t, os.IsNotExist(err), true)
+	}, func(opts *Options) {
+		opts.ProfileName = "named.out"
+		opts.KeepProfiles = true
+		opts.Includes = []string{"good"}
+	})
+
+	os.Remove(named)
+}
+
+func TestOveralls_WithProfiles(t *testing.T) {
+	defer cleanFixtures()
+
+	dir := srcPath + "github.com/go-playground/overalls/test-files/good/"
+	files := []string{dir + "cpu.pprof", dir + "mem.pprof", dir + "good.test"}
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "-cpuprofile=cpu.pprof -memprofile=mem.pprof -o="+regexp.QuoteMeta(dir)+" ")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+
+		for _, f := range files {
+			_, err := os.Stat(f)
+			Equal(t, err, nil)
+		}
+	}, func(opts *Options) {
+		opts.CPUProfile = "cpu.pprof"
+		opts.MemProfile = "mem.pprof"
+		opts.Includes = []string{"good"}
+	})
+
+	for _, f := range files {
+		os.Remove(f)
 	}
 }
+
+func TestOveralls_WithMerge(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	merge := filepath.Join(dir, "existing.coverprofile")
+	err = ioutil.WriteFile(merge, []byte(`mode: count
+github.com/go-playground/overalls/test-files/good/main.go:4.2,5.1 1 2
+example.com/other/other.go:3.14,5.2 1 0
+`), 0644)
+	Equal(t, err, nil)
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		final := string(fileBytes)
+		Equal(t, strings.Count(final, "mode: "), 1)
+		Equal(t, strings.Count(final, "test-files/good/main.go"), 1)
+		NotEqual(t, strings.Index(final, "github.com/go-playground/overalls/test-files/good/main.go:4.2,5.1 1 3\n"), -1)
+		NotEqual(t, strings.Index(final, "example.com/other/other.go:3.14,5.2 1 0\n"), -1)
+		NotEqual(t, strings.Index(final, "test-files/good2/main.go"), -1)
+	}, func(opts *Options) { opts.Merge = merge })
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", CoverMode: "set", Merge: merge})
+	Equal(t, err.Error(), "invalid merge profile '"+merge+"', covermode 'count' does not match 'set'")
+
+	err = ioutil.WriteFile(merge, []byte("not a profile\n"), 0644)
+	Equal(t, err, nil)
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Merge: merge})
+	Equal(t, err.Error(), "invalid merge profile '"+merge+"', missing mode line")
+}
+
+func TestOveralls_WithGoCmd(t *testing.T) {
+	defer cleanFixtures()
+
+	gocmd, err := exec.LookPath("go")
+	Equal(t, err, nil)
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "Processing: "+regexp.QuoteMeta(gocmd)+" test")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) { opts.GoCmd = gocmd })
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", GoCmd: "does-not-exist-go"})
+	Equal(t, err, ErrPackagesFailed)
+	Equal(t, len(res.Failed()), len(res.Packages))
+	Equal(t, res.Packages[0].ExitCode, -1)
+}
+
+func TestOveralls_WithRace(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "WARNING: -race requires covermode atomic")
+		MatchRegex(t, string(output), "go test -race -covermode=atomic")
+		MatchRegex(t, string(fileBytes), "^mode: atomic\n")
+	}, func(opts *Options) { opts.Race = true })
+}
+
+func TestOveralls_WithShort(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "go test -race -short -tags=integration")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/tagged/tagged.go"), -1)
+	}, func(opts *Options) {
+		opts.Race = true
+		opts.Short = true
+		opts.Tags = "integration"
+	})
+}
+
+func TestOveralls_WithCPU(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "go test -cpu=1,2 ")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go:4.2,5.1 1 2\n"), -1)
+	}, func(opts *Options) { opts.CPU = "1,2" })
+}
+
+func TestOveralls_WithCount(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "go test -count=1 ")
+		Equal(t, strings.Index(string(output), "(cached)"), -1)
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go:4.2,5.1 1 1\n"), -1)
+	}, func(opts *Options) { opts.Count = 1 })
+}
+
+func TestOveralls_WithParallel(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "go test -parallel=2 ")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) { opts.Parallel = 2 })
+
+	_, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", Parallel: -1})
+	Equal(t, err.Error(), "invalid parallel '-1', must not be negative")
+}
+
+func TestOveralls_WithOutputStdout(t *testing.T) {
+	buff := &bytes.Buffer{}
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", Output: "-", Stdout: buff})
+	Equal(t, err, nil)
+	Equal(t, res.Output, "-")
+
+	MatchRegex(t, buff.String(), "^mode: count\n")
+	NotEqual(t, strings.Index(buff.String(), "test-files/good/main.go"), -1)
+}
+
+func TestOveralls_DryRun(t *testing.T) {
+	os.Remove(srcPath + "github.com/go-playground/overalls/test-files/overalls.coverprofile")
+
+	out := &bytes.Buffer{}
+	res, err := Run(Options{
+		Project: "github.com/go-playground/overalls/test-files",
+		Ignores: []string{"good2"},
+		DryRun:  true,
+		Logger:  log.New(out, "", 0),
+	})
+	Equal(t, err, nil)
+	Equal(t, res.Output, "")
+	Equal(t, len(res.Packages), 2)
+
+	MatchRegex(t, out.String(), "Would test: github.com/go-playground/overalls/test-files/good\n")
+	MatchRegex(t, out.String(), "DIR good2 ignored, skipping\n")
+	MatchRegex(t, out.String(), "No Go test files in no-test-files, skipping\n")
+	MatchRegex(t, out.String(), "No Go test files in \\., skipping\n")
+	NotMatchRegex(t, out.String(), "Test package:")
+
+	_, err = os.Stat(srcPath + "github.com/go-playground/overalls/test-files/overalls.coverprofile")
+	Equal(t, os.IsNotExist(err), true)
+}
+
+func TestList(t *testing.T) {
+	os.Remove(srcPath + "github.com/go-playground/overalls/test-files/overalls.coverprofile")
+
+	packages, err := List(context.Background(), Options{
+		Project: "github.com/go-playground/overalls/test-files",
+		Ignores: []string{"good2"},
+	})
+	Equal(t, err, nil)
+	Equal(t, packages, []string{
+		"github.com/go-playground/overalls/test-files/good",
+		"github.com/go-playground/overalls/test-files/module/sub",
+	})
+
+	packages, err = List(context.Background(), Options{
+		Project:  "github.com/go-playground/overalls/test-files",
+		Includes: []string{"tagged"},
+		Tags:     "integration",
+	})
+	Equal(t, err, nil)
+	Equal(t, packages, []string{"github.com/go-playground/overalls/test-files/tagged"})
+
+	_, err = os.Stat(srcPath + "github.com/go-playground/overalls/test-files/overalls.coverprofile")
+	Equal(t, os.IsNotExist(err), true)
+
+	_, err = List(context.Background(), Options{})
+	Equal(t, err.Error(), "invalid project path ''")
+}
+
+func TestOveralls_GoIgnoredDirs(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		for _, dir := range []string{"testdata", "_examples", ".hidden"} {
+			MatchRegex(t, string(output), "DIR "+regexp.QuoteMeta(dir)+" ignored by go, skipping\n")
+			NotMatchRegex(t, string(output), "Test package: .*/"+regexp.QuoteMeta(dir)+"\n")
+			Equal(t, strings.Index(string(fileBytes), "test-files/"+dir+"/"), -1)
+		}
+	}, func(opts *Options) {
+		opts.Ignores = []string{}
+		opts.Debug = true
+	})
+
+	// named as the project it is walked
+	packages, err := List(context.Background(), Options{Project: "github.com/go-playground/overalls/test-files/_examples"})
+	Equal(t, err, nil)
+	Equal(t, packages, []string{"github.com/go-playground/overalls/test-files/_examples"})
+}
+
+func TestOveralls_IncludeVendor(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "DIR vendor vendored, skipping\n")
+		Equal(t, strings.Index(string(fileBytes), "test-files/vendor/"), -1)
+	}, func(opts *Options) {
+		opts.Ignores = []string{}
+		opts.Debug = true
+	})
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "Test package: github.com/go-playground/overalls/test-files/vendor/vendored\n")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/vendor/vendored/vendored.go"), -1)
+	}, func(opts *Options) { opts.IncludeVendor = true })
+}
+
+func TestOveralls_MaxDepth(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "DIR deep/er/est below max-depth, skipping\n")
+		Equal(t, strings.Index(string(fileBytes), "test-files/deep/"), -1)
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	}, func(opts *Options) {
+		opts.MaxDepth = 2
+		opts.Debug = true
+	})
+
+	packages, err := List(context.Background(), Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"deep/..."}, Tags: "deep", MaxDepth: 3})
+	Equal(t, err, nil)
+	Equal(t, packages, []string{"github.com/go-playground/overalls/test-files/deep/er/est"})
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", MaxDepth: -1})
+	Equal(t, err.Error(), "invalid max-depth '-1', must not be negative")
+}
+
+func TestOveralls_SymlinkedProject(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(gopath)
+
+	oldPath, oldModule := os.Getenv("GOPATH"), os.Getenv("GO111MODULE")
+	os.Setenv("GOPATH", gopath)
+	os.Setenv("GO111MODULE", "off")
+	defer func() {
+		os.Setenv("GOPATH", oldPath)
+		os.Setenv("GO111MODULE", oldModule)
+	}()
+
+	dir := filepath.Join(gopath, "src", "example.com", "real")
+
+	files := map[string]string{
+		"a/a.go":      "package a\n\nfunc A() int { return 1 }\n",
+		"a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) { A() }\n",
+		"b/b.go":      "package b\n\nfunc B() int { return 2 }\n",
+		"b/b_test.go": "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) { B() }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		Equal(t, os.MkdirAll(filepath.Dir(path), 0755), nil)
+		Equal(t, ioutil.WriteFile(path, []byte(content), 0644), nil)
+	}
+
+	// example.com/link is the project through a symlink, with a symlink to
+	// one of its packages
+	link := filepath.Join(gopath, "src", "example.com", "link")
+	Equal(t, os.Symlink(dir, link), nil)
+	Equal(t, os.Symlink(filepath.Join(dir, "b"), filepath.Join(dir, "c")), nil)
+
+	out := &bytes.Buffer{}
+
+	res, err := Run(Options{Project: "example.com/link", Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 2)
+	Equal(t, res.Packages[0].ImportPath, "example.com/link/a")
+	Equal(t, res.Packages[0].Coverage, float64(100))
+	Equal(t, res.Output, link+string(filepath.Separator)+"overalls.coverprofile")
+	MatchRegex(t, out.String(), "WARNING: DIR c is a symlink to a directory, not followed as go would not, skipping\n")
+
+	// as an absolute path too
+	packages, err := List(context.Background(), Options{Project: link})
+	Equal(t, err, nil)
+	Equal(t, packages, []string{"example.com/link/a", "example.com/link/b"})
+}
+
+func TestOveralls_SkipIncompatible(t *testing.T) {
+	dir, undo := changedRepo(t)
+	defer undo()
+
+	// built on this platform, but not by go test with cgo disabled
+	files := map[string]string{
+		"e/e.go":      "//go:build cgo\n\npackage e\n\nfunc E() int { return 5 }\n",
+		"e/e_test.go": "//go:build cgo\n\npackage e\n\nimport \"testing\"\n\nfunc TestE(t *testing.T) { E() }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		Equal(t, os.MkdirAll(filepath.Dir(path), 0755), nil)
+		Equal(t, ioutil.WriteFile(path, []byte(content), 0644), nil)
+	}
+
+	if !hasTests(filepath.Join(dir, "e"), "") {
+		t.Skip("cgo is disabled for overalls too")
+	}
+
+	out := &bytes.Buffer{}
+	opts := Options{Project: "example.com/changed", Env: []string{"CGO_ENABLED=0"}, Debug: true, Logger: log.New(out, "", 0)}
+
+	res, err := Run(opts)
+	Equal(t, err, ErrPackagesFailed)
+	Equal(t, len(res.Packages), 5)
+
+	opts.SkipIncompatible = true
+
+	res, err = Run(opts)
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 4)
+	MatchRegex(t, out.String(), "DIR e excluded by build constraints, skipping\n")
+}
+
+func TestOveralls_WithErrLogger(t *testing.T) {
+	defer cleanFixtures()
+
+	for _, quiet := range []bool{false, true} {
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+
+		res, err := Run(Options{
+			Project:   "github.com/go-playground/overalls/test-files",
+			Includes:  []string{"broken"},
+			Tags:      "broken",
+			Quiet:     quiet,
+			Logger:    log.New(out, "", 0),
+			ErrLogger: log.New(errOut, "", 0),
+		})
+		Equal(t, err, ErrPackagesFailed)
+		Equal(t, res.Packages[0].BuildFailed, true)
+
+		// the compile error is on stderr, go test's FAIL line on stdout
+		MatchRegex(t, errOut.String(), "broken_test.go:[0-9]+:[0-9]+: ")
+		NotMatchRegex(t, out.String(), "broken_test.go")
+		MatchRegex(t, out.String(), "FAIL\tgithub.com/go-playground/overalls/test-files/broken \\[build failed\\]")
+		NotMatchRegex(t, errOut.String(), "FAIL")
+
+		os.Remove(res.Output)
+	}
+}
+
+func TestOveralls_InternalPackage(t *testing.T) {
+	defer cleanFixtures()
+
+	opts := Options{
+		Project:  "github.com/go-playground/overalls/test-files",
+		Includes: []string{"internal/..."},
+		Tags:     "internal",
+	}
+
+	res, err := Run(opts)
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Packages[0].ImportPath, "github.com/go-playground/overalls/test-files/internal/foo")
+	Equal(t, res.Packages[0].Coverage, float64(100))
+
+	os.Remove(res.Output)
+
+	// the import go could not resolve is named, whether quiet or not
+	opts.Tags = "unresolved"
+
+	for _, quiet := range []bool{false, true} {
+		opts.Quiet = quiet
+
+		res, err = Run(opts)
+		Equal(t, err, ErrPackagesFailed)
+		Equal(t, res.Packages[0].BuildFailed, true)
+		MatchRegex(t, res.Packages[0].Err.Error(), `^build failed: unresolved import path, .*unresolved_test.go:9:2: cannot find package "github.com/go-playground/overalls/test-files/internal/missing" in any of: exit status 1$`)
+
+		os.Remove(res.Output)
+	}
+}
+
+func TestBuildFailure(t *testing.T) {
+	output := "# example.com/m/nope\n" +
+		"no required module provides package example.com/m/nope; to add it:\n" +
+		"FAIL\texample.com/m/nope [setup failed]\n"
+
+	err := buildFailure(string(unresolvedRegex.Find([]byte(output))), io.EOF)
+	Equal(t, isBuildError(err), true)
+	Equal(t, err.Error(), "build failed: unresolved import path, no required module provides package example.com/m/nope; to add it: EOF")
+	Equal(t, errors.Is(err, io.EOF), true)
+
+	err = buildFailure("", io.EOF)
+	Equal(t, err.Error(), "build failed: EOF")
+}
+
+func TestOveralls_WithTags(t *testing.T) {
+	defer cleanFixtures()
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "No Go test files matching build constraints in tagged, skipping\n")
+		Equal(t, strings.Index(string(fileBytes), "test-files/tagged/tagged.go"), -1)
+	})
+
+	withTestingOveralls(t, func(output []byte, fileBytes []byte) {
+		MatchRegex(t, string(output), "go test -tags=integration")
+		NotEqual(t, strings.Index(string(fileBytes), "test-files/tagged/tagged.go"), -1)
+	}, func(opts *Options) { opts.Tags = "integration" })
+}
+
+func TestOveralls_WithTagsMap(t *testing.T) {
+	defer cleanFixtures()
+
+	out := &bytes.Buffer{}
+
+	res, err := Run(Options{
+		Project:  "github.com/go-playground/overalls/test-files",
+		Includes: []string{"good", "tagged", "flaky"},
+		Tags:     "nested",
+		TagsMap:  []string{"tag*=integration", "tagged=broken", "flaky="},
+		Debug:    true,
+		Logger:   log.New(out, "", 0),
+	})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 2)
+	Equal(t, res.Packages[1].ImportPath, "github.com/go-playground/overalls/test-files/tagged")
+	MatchRegex(t, out.String(), "go test -tags=nested .* github.com/go-playground/overalls/test-files/good\n")
+	MatchRegex(t, out.String(), "go test -tags=integration .* github.com/go-playground/overalls/test-files/tagged\n")
+
+	// no tags at all, so its tests are left out by their constraints
+	MatchRegex(t, out.String(), "No Go test files matching build constraints in flaky, skipping\n")
+
+	os.Remove(res.Output)
+
+	for _, entry := range []string{"integration", "=integration"} {
+		_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", TagsMap: []string{entry}})
+		Equal(t, err.Error(), "invalid tags-map '"+entry+"', must be pattern=tags")
+	}
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", TagsMap: []string{"re:(=integration"}})
+	MatchRegex(t, err.Error(), "^invalid tags-map: ")
+}
+
+func TestOveralls_WithRetries(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	oldEnv := os.Getenv("OVERALLS_FLAKY_MARKER")
+	os.Setenv("OVERALLS_FLAKY_MARKER", filepath.Join(dir, "marker"))
+	defer os.Setenv("OVERALLS_FLAKY_MARKER", oldEnv)
+
+	project := "github.com/go-playground/overalls/test-files"
+
+	out := &bytes.Buffer{}
+
+	res, err := Run(Options{Project: project, Includes: []string{"flaky"}, Tags: "flaky", Quiet: true, Logger: log.New(out, "", 0)})
+	Equal(t, err, ErrPackagesFailed)
+	MatchRegex(t, out.String(), "flaky_test.go:[0-9]+: first attempt")
+	Equal(t, len(res.Failed()), 1)
+	Equal(t, res.Failed()[0].Attempts, 1)
+	Equal(t, res.Failed()[0].ExitCode, 1)
+	Equal(t, res.Failed()[0].BuildFailed, false)
+
+	out.Reset()
+	os.Remove(filepath.Join(dir, "marker"))
+
+	res, err = Run(Options{Project: project, Includes: []string{"flaky"}, Tags: "flaky", Retries: 2, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Packages[0].Attempts, 2)
+	Equal(t, res.Packages[0].ExitCode, 0)
+	Equal(t, res.Packages[0].Coverage, float64(100))
+	MatchRegex(t, out.String(), "Retrying github.com/go-playground/overalls/test-files/flaky \\(1/2\\) after:")
+
+	out.Reset()
+	os.Remove(filepath.Join(dir, "marker"))
+
+	// -count=1 as go test would otherwise use the passing run it cached
+	res, err = Run(Options{Project: project, Includes: []string{"flaky"}, Tags: "flaky", Retries: 2, RetryBackoff: 10 * time.Millisecond, Count: 1, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	Equal(t, res.Packages[0].Attempts, 2)
+	MatchRegex(t, out.String(), "Retrying github.com/go-playground/overalls/test-files/flaky \\(1/2\\) in 10ms after:")
+}
+
+func TestRunner_RetryBackoff(t *testing.T) {
+	r := &runner{opts: Options{RetryBackoff: time.Second}}
+	Equal(t, r.retryBackoff(1), time.Second)
+	Equal(t, r.retryBackoff(3), time.Second)
+
+	r.opts.RetryExponential = true
+	Equal(t, r.retryBackoff(1), time.Second)
+	Equal(t, r.retryBackoff(3), 4*time.Second)
+	Equal(t, r.retryBackoff(100) > 0, true)
+
+	// a canceled run doesn't sit out the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r.ctx = ctx
+	start := time.Now()
+	Equal(t, r.sleep(time.Hour), false)
+	Equal(t, time.Since(start) < time.Minute, true)
+	Equal(t, r.sleep(0), false)
+
+	r.ctx = context.Background()
+	Equal(t, r.sleep(time.Millisecond), true)
+}
+
+func TestOveralls_FailFast(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	oldEnv := os.Getenv("OVERALLS_FLAKY_MARKER")
+	os.Setenv("OVERALLS_FLAKY_MARKER", filepath.Join(dir, "marker"))
+	defer os.Setenv("OVERALLS_FLAKY_MARKER", oldEnv)
+
+	out := &bytes.Buffer{}
+	opts := Options{
+		Project:     "github.com/go-playground/overalls/test-files",
+		Includes:    []string{"flaky", "good*"},
+		Tags:        "flaky",
+		Concurrency: 1,
+		FailFast:    true,
+		Logger:      log.New(out, "", 0),
+	}
+
+	res, err := Run(opts)
+	Equal(t, err, ErrPackagesFailed)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Packages[0].ImportPath, "github.com/go-playground/overalls/test-files/flaky")
+	MatchRegex(t, out.String(), "Stopping after github.com/go-playground/overalls/test-files/flaky failed, -fail-fast is set")
+
+	os.Remove(filepath.Join(dir, "marker"))
+	opts.FailFast = false
+
+	res, err = Run(opts)
+	Equal(t, err, ErrPackagesFailed)
+	Equal(t, len(res.Packages), 3)
+	Equal(t, len(res.Failed()), 1)
+}
+
+func TestOveralls_MaxFailures(t *testing.T) {
+	defer cleanFixtures()
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	oldEnv := os.Getenv("OVERALLS_FLAKY_MARKER")
+	os.Setenv("OVERALLS_FLAKY_MARKER", filepath.Join(dir, "marker"))
+	defer os.Setenv("OVERALLS_FLAKY_MARKER", oldEnv)
+
+	out := &bytes.Buffer{}
+	opts := Options{
+		Project:     "github.com/go-playground/overalls/test-files",
+		Includes:    []string{"broken", "flaky", "good*"},
+		Tags:        "broken,flaky",
+		Concurrency: 1,
+		MaxFailures: 2,
+		Logger:      log.New(out, "", 0),
+	}
+
+	res, err := Run(opts)
+	Equal(t, err, ErrPackagesFailed)
+	Equal(t, len(res.Packages), 2)
+	Equal(t, len(res.Failed()), 2)
+	MatchRegex(t, out.String(), "Stopping after github.com/go-playground/overalls/test-files/flaky failed, 2 packages failed and -max-failures is 2\n")
+
+	fileBytes, err := ioutil.ReadFile(res.Output)
+	Equal(t, err, nil)
+	Equal(t, string(fileBytes), "mode: count\n")
+
+	os.Remove(filepath.Join(dir, "marker"))
+	opts.MaxFailures = 3
+
+	res, err = Run(opts)
+	Equal(t, err, ErrPackagesFailed)
+	Equal(t, len(res.Packages), 4)
+	Equal(t, len(res.Failed()), 2)
+
+	os.Remove(res.Output)
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", MaxFailures: -1})
+	Equal(t, err.Error(), "invalid max-failures '-1', must not be negative")
+}
+
+func TestGoPath(t *testing.T) {
+	Equal(t, GoPath(), os.Getenv("GOPATH"))
+
+	home, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(home)
+
+	oldGopath, oldHome := os.Getenv("GOPATH"), os.Getenv("HOME")
+	os.Setenv("GOPATH", "")
+	os.Setenv("HOME", home)
+	defer os.Setenv("GOPATH", oldGopath)
+	defer os.Setenv("HOME", oldHome)
+
+	Equal(t, GoPath(), filepath.Join(home, "go"))
+}
+
+func TestOveralls_Skipped(t *testing.T) {
+	defer cleanFixtures()
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"skipped"}, Tags: "skipped"})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Packages[0].Err, nil)
+	Equal(t, res.Packages[0].Coverage, float64(0))
+}
+
+func TestReadProfile(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := &runner{opts: Options{Debug: true}, logger: log.New(out, "", 0)}
+
+	b, err := r.readProfile("does-not-exist")
+	Equal(t, err, nil)
+	Equal(t, len(b), 0)
+	MatchRegex(t, out.String(), "No coverprofile written for does-not-exist, no coverage contributed\n")
+}
+
+func TestOveralls_Projects(t *testing.T) {
+	defer cleanFixtures()
+
+	res, err := Run(Options{
+		Project:  "github.com/go-playground/overalls/test-files/good",
+		Projects: []string{"github.com/go-playground/overalls/test-files/good2"},
+	})
+	Equal(t, err, nil)
+	Equal(t, res.Output, srcPath+"github.com/go-playground/overalls/test-files/good/overalls.coverprofile")
+	defer os.Remove(res.Output)
+
+	fileBytes, err := ioutil.ReadFile(res.Output)
+	Equal(t, err, nil)
+	NotEqual(t, strings.Index(string(fileBytes), "test-files/good/main.go"), -1)
+	NotEqual(t, strings.Index(string(fileBytes), "test-files/good2/main.go"), -1)
+	Equal(t, len(res.Summary), 2)
+	Equal(t, res.Packages[0].ImportPath, "github.com/go-playground/overalls/test-files/good")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Projects: []string{""}})
+	Equal(t, err.Error(), "invalid project path ''")
+}
+
+func TestOveralls_DirProject(t *testing.T) {
+	defer cleanFixtures()
+
+	res, err := Run(Options{Project: srcPath + "github.com/go-playground/overalls/test-files"})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 3)
+	Equal(t, res.Packages[0].ImportPath, "github.com/go-playground/overalls/test-files/good")
+
+	res, err = Run(Options{Project: "./test-files"})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 3)
+
+	oldEnv := os.Getenv("GO111MODULE")
+	os.Setenv("GO111MODULE", "off")
+	defer os.Setenv("GO111MODULE", oldEnv)
+
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	Equal(t, err, nil)
+	err = ioutil.WriteFile(filepath.Join(dir, "sub", "sub.go"), []byte("package sub\n\nfunc Sub() int {\n\treturn 1\n}\n"), 0644)
+	Equal(t, err, nil)
+	err = ioutil.WriteFile(filepath.Join(dir, "sub", "sub_test.go"), []byte("package sub\n\nimport \"testing\"\n\nfunc TestSub(t *testing.T) {\n\tSub()\n}\n"), 0644)
+	Equal(t, err, nil)
+
+	res, err = Run(Options{Project: dir})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Packages[0].ImportPath, "_"+filepath.ToSlash(dir)+"/sub")
+	Equal(t, res.Coverage, float64(100))
+}
+
+func TestOveralls_Module(t *testing.T) {
+	defer cleanFixtures()
+
+	oldEnv := os.Getenv("GO111MODULE")
+	os.Setenv("GO111MODULE", "on")
+	defer os.Setenv("GO111MODULE", oldEnv)
+
+	project := srcPath + "github.com/go-playground/overalls/test-files/module"
+
+	out := &bytes.Buffer{}
+	_, err := Run(Options{Project: project, CoverMode: "count", Debug: true, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+
+	fileBytes, err := ioutil.ReadFile(project + "/overalls.coverprofile")
+	Equal(t, err, nil)
+
+	NotEqual(t, strings.Index(string(fileBytes), "example.com/overallsmod/sub/sub.go"), -1)
+	MatchRegex(t, out.String(), "go test .* example.com/overallsmod/sub")
+}
+
+func TestOveralls_ModuleSubdir(t *testing.T) {
+	oldEnv := os.Getenv("GO111MODULE")
+	os.Setenv("GO111MODULE", "on")
+	defer os.Setenv("GO111MODULE", oldEnv)
+
+	wd, err := os.Getwd()
+	Equal(t, err, nil)
+	defer os.Chdir(wd)
+
+	// the go.mod is in the parent, as after cd mymodule/sub
+	Equal(t, os.Chdir(filepath.Join("test-files", "module", "sub")), nil)
+
+	out := &bytes.Buffer{}
+	res, err := Run(Options{Project: ".", Output: "-", Stdout: out})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Packages[0].ImportPath, "example.com/overallsmod/sub")
+	MatchRegex(t, out.String(), "^mode: count\nexample.com/overallsmod/sub/sub.go:")
+}
+
+func TestOveralls_WithRoot(t *testing.T) {
+	oldEnv := os.Getenv("GO111MODULE")
+	os.Setenv("GO111MODULE", "on")
+	defer os.Setenv("GO111MODULE", oldEnv)
+
+	// the module's import path says nothing of where it is
+	root := srcPath + "github.com/go-playground/overalls/test-files/module"
+
+	out := &bytes.Buffer{}
+	res, err := Run(Options{Project: "example.com/overallsmod", Root: root, Output: "-", Stdout: ioutil.Discard, Debug: true, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Packages[0].ImportPath, "example.com/overallsmod/sub")
+	MatchRegex(t, out.String(), "Root: .*/test-files/module/ as example.com/overallsmod\n")
+
+	_, err = Run(Options{Project: "example.com/overallsmod", Root: root + "/missing"})
+	Equal(t, err.Error(), "invalid root '"+root+"/missing', must be a directory")
+
+	_, err = Run(Options{Project: "example.com/overallsmod", Projects: []string{"example.com/other"}, Root: root})
+	Equal(t, err.Error(), "invalid root '"+root+"', can't be used with several projects")
+}
+
+func TestOveralls_WithPrebuild(t *testing.T) {
+	defer cleanFixtures()
+
+	out := &bytes.Buffer{}
+
+	opts := Options{
+		Project:  "github.com/go-playground/overalls/test-files",
+		Includes: []string{"good"},
+		Tags:     "broken",
+		Prebuild: "build",
+		Debug:    true,
+		Logger:   log.New(out, "", 0),
+	}
+
+	// only the test files are broken
+	res, err := Run(opts)
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 1)
+	MatchRegex(t, out.String(), "Prebuild: go build -tags=broken ./... in ")
+
+	os.Remove(res.Output)
+
+	out.Reset()
+	opts.Prebuild = "vet"
+
+	res, err = Run(opts)
+	Equal(t, err, ErrPrebuildFailed)
+	Equal(t, len(res.Packages), 0)
+	MatchRegex(t, out.String(), "ERROR: go vet -tags=broken ./... failed in '.*test-files/': exit status 1\n(.|\n)*broken_test.go")
+	NotMatchRegex(t, out.String(), "Test package:")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Prebuild: "test"})
+	Equal(t, err.Error(), "invalid prebuild 'test', must be build or vet")
+}
+
+func TestOveralls_WithMod(t *testing.T) {
+	defer cleanFixtures()
+
+	oldEnv, oldFlags := os.Getenv("GO111MODULE"), os.Getenv("GOFLAGS")
+	os.Setenv("GO111MODULE", "on")
+	defer os.Setenv("GO111MODULE", oldEnv)
+	defer os.Setenv("GOFLAGS", oldFlags)
+
+	project := srcPath + "github.com/go-playground/overalls/test-files/module"
+
+	out := &bytes.Buffer{}
+	_, err := Run(Options{Project: project, Mod: "readonly", Debug: true, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	MatchRegex(t, out.String(), "Module mode: -mod=readonly\n")
+	MatchRegex(t, out.String(), "go test -mod=readonly .* example.com/overallsmod/sub\n")
+
+	os.Setenv("GOFLAGS", "-mod=vendor -v --mod=mod")
+
+	out.Reset()
+	_, err = Run(Options{Project: project, Debug: true, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	MatchRegex(t, out.String(), "Module mode: -mod=mod from GOFLAGS\n")
+
+	os.Setenv("GOFLAGS", oldFlags)
+
+	// go rejects -mod outside of modules
+	os.Setenv("GO111MODULE", "off")
+
+	out.Reset()
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"good"}, Mod: "vendor", Debug: true, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	MatchRegex(t, out.String(), "Module mode: off, GOPATH\n")
+	NotMatchRegex(t, out.String(), "-mod=vendor")
+
+	_, err = Run(Options{Project: project, Mod: "bogus"})
+	Equal(t, err.Error(), "invalid mod 'bogus', must be readonly, vendor or mod")
+}
+
+func TestOveralls_NestedModule(t *testing.T) {
+	defer cleanFixtures()
+
+	oldEnv := os.Getenv("GO111MODULE")
+	os.Setenv("GO111MODULE", "on")
+	defer os.Setenv("GO111MODULE", oldEnv)
+
+	project := srcPath + "github.com/go-playground/overalls/test-files/module"
+
+	out := &bytes.Buffer{}
+	res, err := Run(Options{Project: project, Tags: "nested", Debug: true, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	Equal(t, len(res.Packages), 2)
+	Equal(t, res.Packages[0].ImportPath, "example.com/overallsmod/sub")
+	Equal(t, res.Packages[1].ImportPath, "example.com/overallsnested")
+
+	fileBytes, err := ioutil.ReadFile(project + "/overalls.coverprofile")
+	Equal(t, err, nil)
+
+	NotEqual(t, strings.Index(string(fileBytes), "example.com/overallsmod/sub/sub.go"), -1)
+	NotEqual(t, strings.Index(string(fileBytes), "example.com/overallsnested/nested.go"), -1)
+	MatchRegex(t, out.String(), "Module: example.com/overallsnested in .*/test-files/module/nested\n")
+	MatchRegex(t, out.String(), "go test -tags=nested .* example.com/overallsnested\n")
+}
+
+func TestOveralls_Result(t *testing.T) {
+	defer cleanFixtures()
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files"})
+	Equal(t, err, nil)
+	Equal(t, res.Output, srcPath+"github.com/go-playground/overalls/test-files/overalls.coverprofile")
+	Equal(t, len(res.Packages), 3)
+	Equal(t, len(res.Failed()), 0)
+	Equal(t, len(res.Summary), 3)
+	Equal(t, res.Summary[0].Package, "github.com/go-playground/overalls/test-files/good")
+
+	for _, p := range res.Packages {
+		Equal(t, p.Coverage, float64(100))
+	}
+}
+
+func TestWalkRel(t *testing.T) {
+	tests := []struct {
+		root, path, rel string
+	}{
+		{root: "/go/src/x/", path: "/go/src/x/", rel: ""},
+		{root: "/go/src/x/", path: "/go/src/x", rel: ""},
+		{root: "/go/src/x", path: "/go/src/x/", rel: ""},
+		{root: "/go/src/x/", path: "/go/src/x/a", rel: "a"},
+		{root: "/go/src/x", path: "/go/src/x/a/b/", rel: "a/b"},
+		{root: "/go/src/x/", path: "/go/src/x/a/go/src/x/b", rel: "a/go/src/x/b"},
+	}
+
+	for _, tt := range tests {
+		Equal(t, walkRel(filepath.FromSlash(tt.root), filepath.FromSlash(tt.path)), filepath.FromSlash(tt.rel))
+	}
+}
+
+func TestOveralls_RootPackage(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	// the root package is matched as "", not its full path
+	packages, err := List(context.Background(), Options{
+		Project: srcPath + "github.com/go-playground/overalls/test-files/good",
+		Ignores: []string{"re:^/"},
+		Debug:   true,
+		Logger:  log.New(out, "", 0),
+	})
+	Equal(t, err, nil)
+	Equal(t, packages, []string{"github.com/go-playground/overalls/test-files/good"})
+	MatchRegex(t, out.String(), "(^|\n)REL: \n")
+
+	packages, err = List(context.Background(), Options{
+		Project:  "github.com/go-playground/overalls/test-files/good",
+		Includes: []string{"re:^$"},
+	})
+	Equal(t, err, nil)
+	Equal(t, packages, []string{"github.com/go-playground/overalls/test-files/good"})
+}
+
+func TestDirContents(t *testing.T) {
+	dir := srcPath + "github.com/go-playground/overalls/test-files/"
+
+	tests := []struct {
+		dir                     string
+		tests, sources, subdirs bool
+	}{
+		{dir: "good", tests: true, sources: true},
+		{dir: "no-test-files", sources: true},
+		{dir: "no-go-files"},
+		{dir: "module", subdirs: true},
+	}
+
+	for _, tt := range tests {
+		tests, sources, subdirs, err := dirContents(dir + tt.dir)
+		Equal(t, err, nil)
+		Equal(t, tests, tt.tests)
+		Equal(t, sources, tt.sources)
+		Equal(t, subdirs, tt.subdirs)
+	}
+
+	_, _, _, err := dirContents(dir + "missing")
+	NotEqual(t, err, nil)
+}
+
+func TestRunner_TestArgsWindows(t *testing.T) {
+	defer func(sep string) { separator = sep }(separator)
+	separator = `\`
+
+	r := &runner{opts: Options{CoverMode: "count", ProfileName: pkgFilename}}
+
+	p := project{path: `C:\Users\go\src\github.com\x\y\`, pkgPath: "github.com/x/y"}
+	args := r.testArgs(p, `C:\Users\go\src\github.com\x\y\a\b`, `a\b`)
+	Equal(t, args, []string{"test", "-covermode=count", "-coverprofile=" + pkgFilename, `-outputdir=C:\Users\go\src\github.com\x\y\a\b\`, "github.com/x/y/a/b"})
+	Equal(t, p.importPath(`a\b`), "github.com/x/y/a/b")
+
+	p = project{path: `D:\work\y\`, pkgPath: "_D:/work/y", local: true}
+	args = r.testArgs(p, `D:\work\y\a\b`, `a\b`)
+	Equal(t, args[len(args)-2:], []string{`-outputdir=D:\work\y\a\b\`, "./a/b"})
+}
+
+func TestResult_Slowest(t *testing.T) {
+	res := Result{Packages: []PackageResult{
+		{ImportPath: "a", Duration: time.Second},
+		{ImportPath: "b", Duration: 3 * time.Second, Err: io.EOF},
+		{ImportPath: "c", Duration: 2 * time.Second},
+	}}
+
+	slowest := res.Slowest(2)
+	Equal(t, len(slowest), 2)
+	Equal(t, slowest[0].ImportPath, "b")
+	Equal(t, slowest[1].ImportPath, "c")
+	Equal(t, res.Packages[0].ImportPath, "a")
+
+	Equal(t, len(res.Slowest(10)), 3)
+	Equal(t, len(res.Slowest(-1)), 0)
+}
+
+func TestResults_Concurrent(t *testing.T) {
+	var rs results
+	var wg sync.WaitGroup
+
+	for _, pkg := range []string{"c", "a", "d", "b"} {
+		wg.Add(1)
+		go func(pkg string) {
+			defer wg.Done()
+			rs.add(PackageResult{ImportPath: pkg})
+		}(pkg)
+	}
+	wg.Wait()
+
+	packages := rs.sorted()
+	Equal(t, len(packages), 4)
+	Equal(t, packages[0].ImportPath, "a")
+	Equal(t, packages[3].ImportPath, "d")
+
+	// sorting a copy leaves the recorded results to further adds
+	rs.add(PackageResult{ImportPath: "0"})
+	Equal(t, len(packages), 4)
+	Equal(t, rs.sorted()[0].ImportPath, "0")
+}
+
+func TestOveralls_OnEvent(t *testing.T) {
+	defer cleanFixtures()
+
+	var mu sync.Mutex
+	events := map[EventType][]string{}
+
+	_, err := Run(Options{
+		Project: "github.com/go-playground/overalls/test-files",
+		OnEvent: func(e Event) {
+			mu.Lock()
+			events[e.Type] = append(events[e.Type], e.ImportPath)
+			mu.Unlock()
+
+			if e.Type == EventDone {
+				Equal(t, e.Coverage, float64(100))
+				Equal(t, e.Attempts, 1)
+			}
+		},
+	})
+	Equal(t, err, nil)
+	Equal(t, len(events[EventStart]), 3)
+	Equal(t, len(events[EventDone]), 3)
+	Equal(t, len(events[EventFailed]), 0)
+}
+
+func TestOveralls_FailUnder(t *testing.T) {
+	defer cleanFixtures()
+
+	out := &bytes.Buffer{}
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", FailUnder: 80, Logger: log.New(out, "", 0)})
+	Equal(t, err, nil)
+	Equal(t, res.Coverage, float64(100))
+	MatchRegex(t, out.String(), "Total coverage: 100.0% of statements, minimum 80.0%")
+
+	res, err = Run(Options{Project: "github.com/go-playground/overalls/test-files/no-test-files", FailUnder: 80, AllowEmpty: true})
+	Equal(t, err, ErrCoverageTooLow)
+	Equal(t, res.Coverage, float64(0))
+}
+
+func TestOveralls_PackageMinimums(t *testing.T) {
+	dir, undo := changedRepo(t)
+	defer undo()
+
+	// half of c is tested
+	err := ioutil.WriteFile(filepath.Join(dir, "c", "c.go"), []byte("package c\n\nfunc C() int { return 3 }\n\nfunc D() int { return 4 }\n"), 0644)
+	Equal(t, err, nil)
+
+	opts := Options{Project: "example.com/changed", PackageMinimums: []string{"example.com/changed/a=100", "example.com/changed/c=40"}}
+
+	res, err := Run(opts)
+	Equal(t, err, nil)
+	Equal(t, len(res.BelowMinimum), 0)
+
+	// the first match applies
+	opts.PackageMinimums = []string{"re:/c$=60", "example.com/changed/...=10"}
+
+	res, err = Run(opts)
+	Equal(t, err, ErrPackageCoverageTooLow)
+	Equal(t, res.BelowMinimum, []PackageMinimum{{Package: "example.com/changed/c", Coverage: 50, Minimum: 60}})
+
+	// the others must reach FailUnder
+	opts.PackageMinimums = []string{"example.com/changed/a=100"}
+	opts.FailUnder = 60
+
+	res, err = Run(opts)
+	Equal(t, err, ErrPackageCoverageTooLow)
+	Equal(t, res.BelowMinimum, []PackageMinimum{{Package: "example.com/changed/c", Coverage: 50, Minimum: 60}})
+
+	for _, entry := range []string{"=80", "example.com/changed", "a=101", "a=x"} {
+		_, err = Run(Options{Project: "example.com/changed", PackageMinimums: []string{entry}})
+		NotEqual(t, err, nil)
+		MatchRegex(t, err.Error(), "^invalid package-min '"+regexp.QuoteMeta(entry)+"', ")
+
+		// as Run reports it
+		Equal(t, CheckPackageMinimum(entry).Error(), err.Error())
+	}
+	Equal(t, CheckPackageMinimum("example.com/changed/...=80"), nil)
+}
+
+func TestOveralls_NothingSent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overalls")
+	Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	oldEnv := os.Getenv("OVERALLS_FLAKY_MARKER")
+	os.Setenv("OVERALLS_FLAKY_MARKER", filepath.Join(dir, "marker"))
+	defer os.Setenv("OVERALLS_FLAKY_MARKER", oldEnv)
+
+	type outcome struct {
+		res Result
+		err error
+	}
+	done := make(chan outcome, 1)
+
+	// neither package sends a profile to collect
+	go func() {
+		res, err := Run(Options{
+			Project:     "github.com/go-playground/overalls/test-files",
+			Includes:    []string{"broken", "flaky"},
+			Tags:        "broken,flaky",
+			Concurrency: 1,
+			Output:      filepath.Join(dir, "out.coverprofile"),
+		})
+		done <- outcome{res, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-time.After(2 * time.Minute):
+		t.Fatal("run did not return once every package had failed")
+	}
+
+	Equal(t, o.err, ErrPackagesFailed)
+	Equal(t, len(o.res.Failed()), 2)
+
+	fileBytes, err := ioutil.ReadFile(o.res.Output)
+	Equal(t, err, nil)
+	Equal(t, string(fileBytes), "mode: count\n")
+}
+
+func TestOveralls_NoPackages(t *testing.T) {
+	defer cleanFixtures()
+
+	out := &bytes.Buffer{}
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"typo"}, Logger: log.New(out, "", 0)})
+	Equal(t, err, ErrNoPackages)
+	Equal(t, len(res.Packages), 0)
+	MatchRegex(t, out.String(), "WARNING: no packages were tested")
+
+	fileBytes, err := ioutil.ReadFile(res.Output)
+	Equal(t, err, nil)
+	Equal(t, string(fileBytes), "mode: count\n")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"typo"}, AllowEmpty: true})
+	Equal(t, err, nil)
+}
+
+func TestOveralls_RequireTests(t *testing.T) {
+	defer cleanFixtures()
+
+	res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"good", "no-test-files"}})
+	Equal(t, err, nil)
+	Equal(t, res.Untested, []string{"github.com/go-playground/overalls/test-files/no-test-files"})
+
+	res, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"good", "no-test-files"}, RequireTests: true})
+	Equal(t, err, ErrUntestedPackages)
+	Equal(t, len(res.Packages), 1)
+	Equal(t, res.Coverage, float64(100))
+
+	os.Remove(res.Output)
+
+	// no-go-files holds no package at all
+	res, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"good", "no-go-files"}, RequireTests: true})
+	Equal(t, err, nil)
+	Equal(t, len(res.Untested), 0)
+
+	res, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Includes: []string{"good", "no-test-files"}, DryRun: true})
+	Equal(t, err, nil)
+	Equal(t, res.Untested, []string{"github.com/go-playground/overalls/test-files/no-test-files"})
+}
+
+func TestOveralls_Canceled(t *testing.T) {
+	defer cleanFixtures()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res, err := RunContext(ctx, Options{Project: "github.com/go-playground/overalls/test-files"})
+	Equal(t, err, context.Canceled)
+	Equal(t, len(res.Packages), 0)
+
+	fileBytes, err := ioutil.ReadFile(res.Output)
+	Equal(t, err, nil)
+	Equal(t, string(fileBytes), "mode: count\n")
+}
+
+func TestOveralls_Deadline(t *testing.T) {
+	defer cleanFixtures()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	res, err := RunContext(ctx, Options{Project: "github.com/go-playground/overalls/test-files"})
+	Equal(t, err, context.DeadlineExceeded)
+
+	fileBytes, err := ioutil.ReadFile(res.Output)
+	Equal(t, err, nil)
+	Equal(t, string(fileBytes), "mode: count\n")
+}
+
+func TestOveralls_InvalidOptions(t *testing.T) {
+	_, err := Run(Options{})
+	Equal(t, err.Error(), "invalid project path ''")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", CoverMode: "bad"})
+	Equal(t, err.Error(), "invalid covermode 'bad', must be set, count or atomic")
+
+	_, err = Run(Options{CoverMode: "bad"})
+	Equal(t, err.Error(), "invalid covermode 'bad', must be set, count or atomic")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", CoverMode: "count", Race: true, StrictCoverMode: true})
+	Equal(t, err.Error(), "invalid covermode 'count', -race requires atomic")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Concurrency: -1})
+	Equal(t, err.Error(), "invalid concurrency '-1', must be at least 1")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Count: -1})
+	Equal(t, err.Error(), "invalid count '-1', must not be negative")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", Retries: -1})
+	Equal(t, err.Error(), "invalid retries '-1', must not be negative")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", RetryBackoff: -time.Second})
+	Equal(t, err.Error(), "invalid retry-backoff '-1s', must not be negative")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", PrefixReplace: "=/src/"})
+	Equal(t, err.Error(), "invalid prefix-replace '=/src/', must be old=new")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", ProfileName: "out/profile"})
+	Equal(t, err.Error(), "invalid profile-name 'out/profile', must be a file name")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", CPUProfile: "../cpu.out"})
+	Equal(t, err.Error(), "invalid cpuprofile '../cpu.out', must be a file name other than the profile-name")
+
+	_, err = Run(Options{Project: "github.com/go-playground/overalls/test-files", BlockProfile: pkgFilename})
+	Equal(t, err.Error(), "invalid blockprofile '"+pkgFilename+"', must be a file name other than the profile-name")
+}
+
+// cleanFixtures removes the coverprofiles runs against test-files write
+// beside the projects by default, for tests to defer so testing leaves the
+// fixtures as they were.
+func cleanFixtures() {
+	filepath.Walk(srcPath+"github.com/go-playground/overalls/test-files", func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && info.Name() == outFilename {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+func withTestingOveralls(t *testing.T, fn func(output []byte, coverage []byte), configure ...func(*Options)) {
+	out := &bytes.Buffer{}
+	opts := Options{
+		Project:   "github.com/go-playground/overalls/test-files",
+		CoverMode: "count",
+		Debug:     true,
+		Logger:    log.New(out, "", 0),
+	}
+
+	for _, c := range configure {
+		c(&opts)
+	}
+
+	_, err := Run(opts)
+	Equal(t, err, nil)
+
+	fileBytes, err := ioutil.ReadFile(srcPath + "github.com/go-playground/overalls/test-files/overalls.coverprofile")
+
+	// Ensure no error reading file
+	Equal(t, err, nil)
+	fn(out.Bytes(), fileBytes)
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package overalls
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroup starts cmd in its own process group and, once its context is
+// done, kills the whole group so the test binary go test runs is not left
+// orphaned.
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,237 @@
+package overalls
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PackageCoverage is the statement coverage of a single package directory
+// of the merged profile.
+type PackageCoverage struct {
+	// Package is the import path of the package directory.
+	Package string
+
+	// Statements is the number of statements in the package.
+	Statements int
+
+	// Covered is the number of statements run at least once.
+	Covered int
+
+	// Coverage is the percentage of statements covered.
+	Coverage float64
+}
+
+// block is a single coverage block of a coverprofile, e.g.
+//
+//	github.com/go-playground/overalls/overalls.go:12.34,15.2 3 1
+//
+// where key is everything up to and including the position range.
+type block struct {
+	key     string
+	numStmt int
+	count   int
+}
+
+// checkMode returns an error when any mode line of profile is not mode, as
+// merging the blocks of profiles with different modes is meaningless.
+func checkMode(mode string, profile []byte) error {
+	for _, m := range modeRegex.FindAllSubmatch(profile, -1) {
+		if string(m[1]) != mode {
+			return fmt.Errorf("covermode '%s' does not match '%s'", m[1], mode)
+		}
+	}
+
+	return nil
+}
+
+// file returns the file name portion of the block's key.
+func (b block) file() string {
+	if i := strings.LastIndex(b.key, ":"); i >= 0 {
+		return b.key[:i]
+	}
+
+	return b.key
+}
+
+// excludeBlocks returns the blocks whose file is not matched by exclude, in
+// the same order. blocks is returned as is when exclude is empty.
+func excludeBlocks(blocks []block, exclude patterns) []block {
+	if len(exclude) == 0 {
+		return blocks
+	}
+
+	kept := blocks[:0:0]
+	for _, b := range blocks {
+		if !exclude.match(b.file()) {
+			kept = append(kept, b)
+		}
+	}
+
+	return kept
+}
+
+// mergeBlocks combines the blocks of several coverprofiles. Blocks appearing
+// in more than one profile, as they do when using -coverpkg, are kept once in
+// the order they were first seen, with their counts summed for the count and
+// atomic modes or OR'd for the set mode.
+func mergeBlocks(mode string, blocks []block) []block {
+	m := newMerger(mode)
+	m.add(blocks)
+
+	return m.blocks
+}
+
+// merger combines the blocks of coverprofiles as they arrive, in the same way
+// as mergeBlocks. Every distinct block stays in memory until the end, as
+// merging and sorting need them, but a block measured by several packages
+// with -coverpkg is kept once rather than once per package profile.
+type merger struct {
+	mode   string
+	index  map[string]int
+	blocks []block
+}
+
+// newMerger returns a merger for profiles of the covermode mode.
+func newMerger(mode string) *merger {
+	return &merger{mode: mode, index: map[string]int{}}
+}
+
+// add merges blocks into those already added.
+func (m *merger) add(blocks []block) {
+	for _, b := range blocks {
+		i, found := m.index[b.key]
+		if !found {
+			m.index[b.key] = len(m.blocks)
+			m.blocks = append(m.blocks, b)
+			continue
+		}
+
+		if m.mode == "set" {
+			if b.count > 0 {
+				m.blocks[i].count = 1
+			}
+		} else {
+			m.blocks[i].count += b.count
+		}
+	}
+}
+
+// sorted sorts the merged blocks by file in place, keeping the order of the
+// blocks within each file, so the result doesn't depend on the order the
+// profiles were added in, and returns them. Nothing can be added after, the
+// blocks having moved.
+func (m *merger) sorted() []block {
+	m.index = nil
+	sort.SliceStable(m.blocks, func(i, j int) bool { return m.blocks[i].file() < m.blocks[j].file() })
+
+	return m.blocks
+}
+
+// formatBlocks returns blocks as a coverprofile body, one block per line.
+func formatBlocks(blocks []block) string {
+	buff := &bytes.Buffer{}
+
+	for _, b := range blocks {
+		writeBlock(buff, b)
+	}
+
+	return buff.String()
+}
+
+// writeBlock writes b to w as a coverprofile line.
+func writeBlock(w io.Writer, b block) error {
+	_, err := io.WriteString(w, b.key+" "+strconv.Itoa(b.numStmt)+" "+strconv.Itoa(b.count)+"\n")
+	return err
+}
+
+// parseBlocks parses the blocks of a coverprofile, skipping mode, blank and
+// malformed lines.
+func parseBlocks(profile string) []block {
+	var blocks []block
+
+	for _, line := range strings.Split(profile, "\n") {
+		if b, ok := parseBlock(line); ok {
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks
+}
+
+// parseBlock parses a single coverprofile line, reporting false for blank
+// or malformed lines.
+func parseBlock(line string) (block, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return block{}, false
+	}
+
+	numStmt, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return block{}, false
+	}
+
+	count, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return block{}, false
+	}
+
+	return block{key: fields[0], numStmt: numStmt, count: count}, true
+}
+
+// percentCovered returns the percentage of statements in blocks that were
+// run at least once, or 0 when there are no statements.
+func percentCovered(blocks []block) float64 {
+	var covered, total int
+
+	for _, b := range blocks {
+		total += b.numStmt
+		if b.count > 0 {
+			covered += b.numStmt
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return float64(covered) / float64(total) * 100
+}
+
+// packageCoverage groups blocks by the directory of their file and returns
+// the coverage of each, sorted by package.
+func packageCoverage(blocks []block) []PackageCoverage {
+	var pkgs []PackageCoverage
+	index := map[string]int{}
+
+	for _, b := range blocks {
+		pkg := path.Dir(b.file())
+
+		i, found := index[pkg]
+		if !found {
+			i = len(pkgs)
+			index[pkg] = i
+			pkgs = append(pkgs, PackageCoverage{Package: pkg})
+		}
+
+		pkgs[i].Statements += b.numStmt
+		if b.count > 0 {
+			pkgs[i].Covered += b.numStmt
+		}
+	}
+
+	for i := range pkgs {
+		if pkgs[i].Statements > 0 {
+			pkgs[i].Coverage = float64(pkgs[i].Covered) / float64(pkgs[i].Statements) * 100
+		}
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Package < pkgs[j].Package })
+
+	return pkgs
+}
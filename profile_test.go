@@ -0,0 +1,146 @@
+package overalls
+
+import (
+	"strings"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestMergeBlocks_Count(t *testing.T) {
+	profiles := "github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b.go:7.20,9.2 2 0\n" +
+		"github.com/a/b/b.go:3.20,5.2 1 2\n" +
+		"github.com/a/b/b.go:7.20,9.2 2 3\n" +
+		"github.com/a/c/c.go:3.20,5.2 1 1\n"
+
+	Equal(t, formatBlocks(mergeBlocks("count", parseBlocks(profiles))), "github.com/a/b/b.go:3.20,5.2 1 3\n"+
+		"github.com/a/b/b.go:7.20,9.2 2 3\n"+
+		"github.com/a/c/c.go:3.20,5.2 1 1\n")
+}
+
+func TestMergeBlocks_Set(t *testing.T) {
+	profiles := "github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b.go:7.20,9.2 2 0\n" +
+		"github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b.go:7.20,9.2 2 0\n"
+
+	Equal(t, formatBlocks(mergeBlocks("set", parseBlocks(profiles))), "github.com/a/b/b.go:3.20,5.2 1 1\n"+
+		"github.com/a/b/b.go:7.20,9.2 2 0\n")
+}
+
+func TestMergeBlocks_Modes(t *testing.T) {
+	// the same blocks of github.com/a/b as covered by the tests of two
+	// packages, as with -coverpkg
+	pkgA := "github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b.go:7.20,9.2 2 0\n" +
+		"github.com/a/b/b.go:11.20,13.2 1 0\n"
+	pkgB := "github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b.go:7.20,9.2 2 1\n" +
+		"github.com/a/b/b.go:11.20,13.2 1 0\n" +
+		"github.com/a/c/c.go:3.20,5.2 1 1\n"
+
+	tests := []struct {
+		mode     string
+		profiles string
+		expected string
+	}{
+		{
+			mode:     "set",
+			profiles: pkgA + pkgB,
+			expected: "github.com/a/b/b.go:3.20,5.2 1 1\n" +
+				"github.com/a/b/b.go:7.20,9.2 2 1\n" +
+				"github.com/a/b/b.go:11.20,13.2 1 0\n" +
+				"github.com/a/c/c.go:3.20,5.2 1 1\n",
+		},
+		{
+			mode: "count",
+			profiles: strings.Replace(pkgA, "5.2 1 1", "5.2 1 4", 1) +
+				strings.Replace(pkgB, "9.2 2 1", "9.2 2 3", 1),
+			expected: "github.com/a/b/b.go:3.20,5.2 1 5\n" +
+				"github.com/a/b/b.go:7.20,9.2 2 3\n" +
+				"github.com/a/b/b.go:11.20,13.2 1 0\n" +
+				"github.com/a/c/c.go:3.20,5.2 1 1\n",
+		},
+		{
+			mode:     "atomic",
+			profiles: pkgA + pkgB + pkgB,
+			expected: "github.com/a/b/b.go:3.20,5.2 1 3\n" +
+				"github.com/a/b/b.go:7.20,9.2 2 2\n" +
+				"github.com/a/b/b.go:11.20,13.2 1 0\n" +
+				"github.com/a/c/c.go:3.20,5.2 1 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		Equal(t, formatBlocks(mergeBlocks(tt.mode, parseBlocks(tt.profiles))), tt.expected)
+	}
+}
+
+func TestMergeBlocks_SkipsMalformed(t *testing.T) {
+	profiles := "\ngarbage\ngithub.com/a/b/b.go:3.20,5.2 1 x\ngithub.com/a/b/b.go:3.20,5.2 1 1\n"
+
+	Equal(t, formatBlocks(mergeBlocks("count", parseBlocks(profiles))), "github.com/a/b/b.go:3.20,5.2 1 1\n")
+}
+
+func TestMerger_Sorted(t *testing.T) {
+	m := newMerger("count")
+	m.add(parseBlocks("github.com/a/c/c.go:3.20,5.2 1 1\n"))
+	m.add(parseBlocks("github.com/a/b/b.go:7.20,9.2 2 0\n" +
+		"github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/c/c.go:3.20,5.2 1 2\n"))
+
+	Equal(t, formatBlocks(m.sorted()), "github.com/a/b/b.go:7.20,9.2 2 0\n"+
+		"github.com/a/b/b.go:3.20,5.2 1 1\n"+
+		"github.com/a/c/c.go:3.20,5.2 1 3\n")
+
+	// sorted in place rather than copied
+	Equal(t, m.blocks[0].file(), "github.com/a/b/b.go")
+}
+
+func TestPercentCovered(t *testing.T) {
+	blocks := parseBlocks("mode: count\n" +
+		"github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b.go:7.20,9.2 3 0\n")
+
+	Equal(t, percentCovered(blocks), float64(25))
+	Equal(t, percentCovered(nil), float64(0))
+}
+
+func TestPackageCoverage(t *testing.T) {
+	blocks := parseBlocks("github.com/a/c/c.go:3.20,5.2 1 0\n" +
+		"github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b2.go:7.20,9.2 3 0\n" +
+		"github.com/a/c/c.go:7.20,9.2 1 2\n")
+
+	Equal(t, packageCoverage(blocks), []PackageCoverage{
+		{Package: "github.com/a/b", Statements: 4, Covered: 1, Coverage: 25},
+		{Package: "github.com/a/c", Statements: 2, Covered: 1, Coverage: 50},
+	})
+}
+
+func TestExcludeBlocks(t *testing.T) {
+	blocks := parseBlocks("github.com/a/b/b.go:3.20,5.2 1 1\n" +
+		"github.com/a/b/b.pb.go:3.20,5.2 1 0\n" +
+		"github.com/a/b/mock_b.go:3.20,5.2 1 0\n" +
+		"github.com/a/c/c.go:7.20,9.2 1 2\n")
+
+	exclude, err := newPatterns([]string{"*.pb.go", "mock_*.go"})
+	Equal(t, err, nil)
+
+	Equal(t, excludeBlocks(blocks, exclude), []block{blocks[0], blocks[3]})
+	Equal(t, excludeBlocks(blocks, nil), blocks)
+
+	exclude, err = newPatterns([]string{"github.com/a/b/..."})
+	Equal(t, err, nil)
+
+	Equal(t, excludeBlocks(blocks, exclude), []block{blocks[3]})
+}
+
+func TestCheckMode(t *testing.T) {
+	Equal(t, checkMode("count", []byte("mode: count\ngithub.com/a/b/b.go:3.20,5.2 1 1\n")), nil)
+
+	err := checkMode("count", []byte("mode: set\ngithub.com/a/b/b.go:3.20,5.2 1 1\n"))
+	NotEqual(t, err, nil)
+	Equal(t, err.Error(), "covermode 'set' does not match 'count'")
+}
@@ -0,0 +1,5 @@
+package hidden
+
+func TestFiles() error {
+	return nil
+}
@@ -0,0 +1,5 @@
+package examples
+
+func TestFiles() error {
+	return nil
+}
@@ -0,0 +1,10 @@
+package examples
+
+import "testing"
+
+// go ignores this directory, so overalls must as well
+func TestIgnored(t *testing.T) {
+	if err := TestFiles(); err != nil {
+		t.Fatal(err)
+	}
+}
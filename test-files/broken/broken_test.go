@@ -0,0 +1,11 @@
+//go:build broken
+// +build broken
+
+package broken
+
+import "testing"
+
+func TestBroken(t *testing.T) {
+	var n int = TestFiles()
+	t.Log(n)
+}
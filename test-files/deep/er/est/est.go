@@ -0,0 +1,5 @@
+package est
+
+func TestFiles() error {
+	return nil
+}
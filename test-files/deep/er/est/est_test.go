@@ -0,0 +1,12 @@
+//go:build deep
+// +build deep
+
+package est
+
+import "testing"
+
+func TestDeep(t *testing.T) {
+	if err := TestFiles(); err != nil {
+		t.Fatal(err)
+	}
+}
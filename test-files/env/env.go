@@ -0,0 +1,5 @@
+package env
+
+func TestFiles() error {
+	return nil
+}
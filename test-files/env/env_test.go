@@ -0,0 +1,19 @@
+//go:build env
+// +build env
+
+package env
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnv(t *testing.T) {
+	if v := os.Getenv("OVERALLS_ENV"); v != "a=b" {
+		t.Fatalf("OVERALLS_ENV is '%s'", v)
+	}
+
+	if err := TestFiles(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,5 @@
+package external
+
+func TestFiles() error {
+	return nil
+}
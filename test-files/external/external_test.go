@@ -0,0 +1,16 @@
+//go:build external
+// +build external
+
+package external_test
+
+import (
+	"testing"
+
+	"github.com/go-playground/overalls/test-files/external"
+)
+
+func TestExternal(t *testing.T) {
+	if err := external.TestFiles(); err != nil {
+		t.Fatal(err)
+	}
+}
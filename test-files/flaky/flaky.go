@@ -0,0 +1,5 @@
+package flaky
+
+func TestFiles() error {
+	return nil
+}
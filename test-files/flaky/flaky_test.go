@@ -0,0 +1,25 @@
+//go:build flaky
+// +build flaky
+
+package flaky
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+// TestFlaky fails the first time it is run, creating the file named by
+// OVERALLS_FLAKY_MARKER, and passes once that file exists.
+func TestFlaky(t *testing.T) {
+	marker := os.Getenv("OVERALLS_FLAKY_MARKER")
+	if _, err := os.Stat(marker); os.IsNotExist(err) {
+		ioutil.WriteFile(marker, nil, 0644)
+		t.Fatal("first attempt")
+	}
+
+	err := TestFiles()
+	Equal(t, err, nil)
+}
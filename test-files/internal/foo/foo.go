@@ -0,0 +1,5 @@
+package foo
+
+func TestFiles() error {
+	return nil
+}
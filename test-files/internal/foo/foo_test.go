@@ -0,0 +1,16 @@
+//go:build internal
+// +build internal
+
+package foo_test
+
+import (
+	"testing"
+
+	"github.com/go-playground/overalls/test-files/internal/foo"
+)
+
+func TestInternal(t *testing.T) {
+	if err := foo.TestFiles(); err != nil {
+		t.Fatal(err)
+	}
+}
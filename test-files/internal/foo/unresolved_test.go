@@ -0,0 +1,14 @@
+//go:build unresolved
+// +build unresolved
+
+package foo_test
+
+import (
+	"testing"
+
+	"github.com/go-playground/overalls/test-files/internal/missing"
+)
+
+func TestUnresolved(t *testing.T) {
+	missing.TestFiles()
+}
@@ -0,0 +1,3 @@
+module example.com/overallsmod
+
+go 1.16
@@ -0,0 +1,3 @@
+module example.com/overallsnested
+
+go 1.16
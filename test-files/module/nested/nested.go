@@ -0,0 +1,5 @@
+package nested
+
+func TestFiles() error {
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build nested
+// +build nested
+
+package nested
+
+import "testing"
+
+func TestNested(t *testing.T) {
+	if err := TestFiles(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,5 @@
+package sub
+
+func TestFiles() error {
+	return nil
+}
@@ -0,0 +1,9 @@
+package sub
+
+import "testing"
+
+func TestGood(t *testing.T) {
+	if err := TestFiles(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,5 @@
+package skipped
+
+func TestFiles() error {
+	return nil
+}
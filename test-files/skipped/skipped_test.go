@@ -0,0 +1,10 @@
+//go:build skipped
+// +build skipped
+
+package skipped
+
+import "testing"
+
+func TestSkipped(t *testing.T) {
+	t.Skip("always skipped")
+}
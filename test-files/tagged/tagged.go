@@ -0,0 +1,5 @@
+package tagged
+
+func TestFiles() error {
+	return nil
+}
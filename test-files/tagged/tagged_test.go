@@ -0,0 +1,15 @@
+//go:build integration
+// +build integration
+
+package tagged
+
+import (
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestTagged(t *testing.T) {
+	err := TestFiles()
+	Equal(t, err, nil)
+}
@@ -0,0 +1,30 @@
+package lcov
+
+import "strings"
+
+// Classify describes n, the comment and blank line below are not code.
+func Classify(n int) string {
+
+	if n < 0 {
+		return "negative"
+	} else if n == 0 {
+		return "zero"
+	}
+
+	words := []string{
+		"positive",
+	}
+
+	switch {
+	case n > 100:
+		words = append(words, "large")
+	case n > 10:
+		words = append(words, "medium")
+	}
+
+	for i := 0; i < 2; i++ {
+		n++
+	}
+
+	return strings.Join(words, " ")
+}
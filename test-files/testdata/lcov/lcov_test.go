@@ -0,0 +1,9 @@
+package lcov
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	for _, n := range []int{-1, 50} {
+		Classify(n)
+	}
+}
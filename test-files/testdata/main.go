@@ -0,0 +1,5 @@
+package testdata
+
+func TestFiles() error {
+	return nil
+}
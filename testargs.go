@@ -0,0 +1,65 @@
+package overalls
+
+import (
+	"fmt"
+	"strings"
+)
+
+// valueFlags are the go test and build flags taking a value, which may be
+// given either as -flag=value or as -flag value.
+var valueFlags = map[string]bool{
+	"bench": true, "benchtime": true, "blockprofile": true, "blockprofilerate": true,
+	"count": true, "covermode": true, "coverpkg": true, "coverprofile": true,
+	"cpu": true, "cpuprofile": true, "fuzz": true, "fuzzcachedir": true,
+	"fuzzminimizetime": true, "fuzztime": true, "list": true, "memprofile": true,
+	"memprofilerate": true, "mutexprofile": true, "mutexprofilefraction": true,
+	"outputdir": true, "parallel": true, "run": true, "shuffle": true,
+	"skip": true, "timeout": true, "trace": true, "vet": true,
+	"C": true, "asmflags": true, "buildmode": true, "compiler": true,
+	"exec": true, "gccgoflags": true, "gcflags": true, "installsuffix": true,
+	"ldflags": true, "mod": true, "modfile": true, "o": true, "overlay": true,
+	"p": true, "pgo": true, "pkgdir": true, "tags": true, "toolexec": true,
+}
+
+// splitTestArgs splits the Options.TestArgs args at -args, returning the
+// flags for go test and those for the test binary, -args included, which
+// go test only leaves to the binary after the package. A flag taking a value
+// given as -flag value keeps its value, even one spelled -args; it returns an
+// error for one missing its value, which would otherwise take the next
+// argument overalls passes.
+func splitTestArgs(args []string) ([]string, []string, error) {
+	for i := 0; i < len(args); i++ {
+		name, hasValue := flagName(args[i])
+
+		if name == "args" {
+			return args[:i], args[i:], nil
+		}
+
+		if valueFlags[name] && !hasValue {
+			if i+1 == len(args) {
+				return nil, nil, fmt.Errorf("invalid test flag '%s', missing its value", args[i])
+			}
+			i++
+		}
+	}
+
+	return args, nil, nil
+}
+
+// flagName returns the name of the flag arg, without its dashes or any
+// test. prefix, and whether its value is joined to it with '='. It returns
+// an empty name for an argument that isn't a flag.
+func flagName(arg string) (string, bool) {
+	if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	name = strings.TrimPrefix(name, "test.")
+
+	if i := strings.IndexByte(name, '='); i >= 0 {
+		return name[:i], true
+	}
+
+	return name, false
+}
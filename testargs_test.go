@@ -0,0 +1,69 @@
+package overalls
+
+import (
+	"testing"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestRunner_TestArgsFlagStyles(t *testing.T) {
+	defer func(sep string) { separator = sep }(separator)
+	separator = "/"
+
+	coverage := []string{"-covermode=count", "-coverprofile=" + pkgFilename, "-outputdir=/go/src/github.com/x/y/a/", "github.com/x/y/a"}
+
+	tests := []struct {
+		in     []string
+		before []string
+		after  []string
+	}{
+		{in: []string{"-run=TestFoo"}, before: []string{"-run=TestFoo"}},
+		{in: []string{"-run", "TestFoo"}, before: []string{"-run", "TestFoo"}},
+		{in: []string{"--run", "TestFoo", "-v"}, before: []string{"--run", "TestFoo", "-v"}},
+		{in: []string{"-test.run", "TestFoo"}, before: []string{"-test.run", "TestFoo"}},
+		{in: []string{"-count", "2", "-failfast", "-timeout=1m"}, before: []string{"-count", "2", "-failfast", "-timeout=1m"}},
+		{in: []string{"-run", "TestFoo", "-args", "-custom", "x"}, before: []string{"-run", "TestFoo"}, after: []string{"-args", "-custom", "x"}},
+		{in: []string{"-args", "-v"}, after: []string{"-args", "-v"}},
+		{in: []string{"-run", "-args"}, before: []string{"-run", "-args"}},
+	}
+
+	for _, tt := range tests {
+		_, _, err := splitTestArgs(tt.in)
+		Equal(t, err, nil)
+
+		r := &runner{opts: Options{CoverMode: "count", ProfileName: pkgFilename, TestArgs: tt.in}}
+
+		p := project{path: "/go/src/github.com/x/y/", pkgPath: "github.com/x/y"}
+
+		want := append([]string{"test"}, tt.before...)
+		want = append(want, coverage...)
+		want = append(want, tt.after...)
+
+		Equal(t, r.testArgs(p, "/go/src/github.com/x/y/a", "a"), want)
+	}
+}
+
+func TestSplitTestArgs_Errors(t *testing.T) {
+	for _, args := range [][]string{{"-run"}, {"-v", "-count"}, {"--timeout"}, {"-test.run"}} {
+		_, _, err := splitTestArgs(args)
+		Equal(t, err.Error(), "invalid test flag '"+args[len(args)-1]+"', missing its value")
+	}
+
+	_, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", TestArgs: []string{"-v", "-run"}})
+	Equal(t, err.Error(), "invalid test flag '-run', missing its value")
+
+	// a value-less flag left for the test binary is its business
+	_, binary, err := splitTestArgs([]string{"-args", "-run"})
+	Equal(t, err, nil)
+	Equal(t, binary, []string{"-args", "-run"})
+}
+
+func TestOveralls_TestArgsStyles(t *testing.T) {
+	defer cleanFixtures()
+
+	for _, args := range [][]string{{"-run=Test"}, {"-run", "Test"}, {"-run", "Test", "-args", "-test.v"}} {
+		res, err := Run(Options{Project: "github.com/go-playground/overalls/test-files", TestArgs: args})
+		Equal(t, err, nil)
+		NotEqual(t, len(res.Packages), 0)
+	}
+}
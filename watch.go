@@ -0,0 +1,242 @@
+package overalls
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often Watch looks for changed files, and how long
+// they must then stay unchanged before testing again, so saving several
+// files at once runs the tests once.
+var watchInterval = 500 * time.Millisecond
+
+// fileStamp is what Watch compares to tell a file changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch runs opts as RunContext does, passing each outcome to fn, then again
+// each time a .go file of the project is added, changed or removed, until
+// ctx is done, returning ctx.Err(). Only the packages whose directories
+// hold the changed files are tested again, along with those depending on
+// them or whose tests import them, the others keeping the coverage of their
+// last run so each profile written stays complete; the Result.Packages of
+// those runs are only the packages tested again. With Options.CoverPkg a
+// package's tests cover others, so every package is tested again. Files are
+// polled, which needs nothing of the OS and no limits raised for large
+// projects.
+//
+// Watch only returns early when opts are invalid, failing runs are passed to
+// fn like any other.
+func Watch(ctx context.Context, opts Options, fn func(Result, error)) error {
+	r := &runner{ctx: ctx, parent: ctx, opts: opts}
+
+	if err := r.init(); err != nil {
+		return err
+	}
+
+	// the first run tests every package, those after only the changed
+	var changed map[string]map[string]bool
+	var carried []block
+
+	// taken before the run so changes made during it are tested next
+	last := r.goFiles()
+
+	for {
+		res, blocks, err := watchRun(ctx, opts, changed, carried)
+		if blocks != nil {
+			carried = blocks
+		}
+
+		fn(res, err)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		r.logger.Println("Watching for changes to .go files")
+
+		files, err := r.waitForChange(last)
+		if err != nil {
+			return err
+		}
+
+		changed = r.changedPackages(last, files)
+		last = files
+
+		r.logger.Println("Files changed, testing again")
+	}
+}
+
+// watchRun runs opts as RunContext does, testing only the directories in
+// changed of each project, by its path, unless changed is nil. The blocks
+// carried from the last run are kept for the packages not tested again.
+// It returns the merged blocks of the run too, nil when none were written.
+func watchRun(ctx context.Context, opts Options, changed map[string]map[string]bool, carried []block) (Result, []block, error) {
+	r := &runner{ctx: ctx, parent: ctx, opts: opts}
+
+	if err := r.init(); err != nil {
+		return Result{}, nil, err
+	}
+
+	if changed != nil {
+		// a change to packages without tests leaves nothing to test
+		r.opts.AllowEmpty = true
+
+		retested := map[string]bool{}
+		for i := range r.projects {
+			p := &r.projects[i]
+			p.changed = changed[p.path]
+			if p.changed == nil {
+				p.changed = map[string]bool{}
+			}
+
+			for rel := range p.changed {
+				retested[p.importPath(rel)] = true
+			}
+		}
+
+		// dropped before the run too, for packages that no longer exist
+		for _, b := range carried {
+			if !retested[path.Dir(b.file())] {
+				r.carried = append(r.carried, b)
+			}
+		}
+	}
+
+	res, err := r.run()
+	return res, r.blocks, err
+}
+
+// carryOver returns the blocks of the packages other than those tested.
+func carryOver(blocks []block, tested []PackageResult) []block {
+	skip := map[string]bool{}
+	for _, p := range tested {
+		skip[p.ImportPath] = true
+	}
+
+	var kept []block
+	for _, b := range blocks {
+		if !skip[path.Dir(b.file())] {
+			kept = append(kept, b)
+		}
+	}
+
+	return kept
+}
+
+// waitForChange returns the .go files of the project once they differ from
+// last and have then stayed unchanged for a whole watchInterval, so the
+// changes made in a burst, such as saving several files at once, are tested
+// together, or ctx.Err() once it is done.
+func (r *runner) waitForChange(last map[string]fileStamp) (map[string]fileStamp, error) {
+	prev := last
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return nil, r.ctx.Err()
+		case <-time.After(watchInterval):
+		}
+
+		files := r.goFiles()
+		if !reflect.DeepEqual(files, prev) {
+			prev = files
+			continue
+		}
+
+		if !reflect.DeepEqual(files, last) {
+			return files, nil
+		}
+	}
+}
+
+// changedPackages returns, by project path, the directories of the packages
+// holding a file added, changed or removed between last and files, relative
+// to the project as the walker sees them, along with those of the packages
+// depending on them. It returns nil, for every package to be tested again,
+// with Options.CoverPkg.
+func (r *runner) changedPackages(last, files map[string]fileStamp) map[string]map[string]bool {
+	if len(r.opts.CoverPkg) > 0 {
+		return nil
+	}
+
+	var names []string
+	for name, stamp := range files {
+		if old, found := last[name]; !found || old != stamp {
+			names = append(names, name)
+		}
+	}
+	for name := range last {
+		if _, found := files[name]; !found {
+			names = append(names, name)
+		}
+	}
+
+	changed := map[string]map[string]bool{}
+
+	for _, p := range r.projects {
+		dirs := map[string]bool{}
+		for _, name := range names {
+			if strings.HasPrefix(name, p.path) {
+				dirs[walkRel(p.path, filepath.Dir(name))] = true
+			}
+		}
+		changed[p.path] = dirs
+
+		if len(dirs) == 0 {
+			continue
+		}
+
+		dir, err := filepath.EvalSymlinks(p.path)
+		if err == nil {
+			err = r.addDependents(p, dir, dirs)
+		}
+		if err != nil {
+			r.logger.Printf("WARNING: unable to list the packages depending on those changed, testing only the changed\n%s\n", err)
+		}
+	}
+
+	return changed
+}
+
+// goFiles returns the .go files of the projects by path, skipping the
+// directories the walk would. Files that can't be read are left out, to be
+// noticed by the run once they can.
+func (r *runner) goFiles() map[string]fileStamp {
+	files := map[string]fileStamp{}
+
+	for _, p := range r.projects {
+		filepath.Walk(p.path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if !info.IsDir() {
+				if strings.HasSuffix(info.Name(), ".go") {
+					files[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+				}
+				return nil
+			}
+
+			rel := walkRel(p.path, path)
+			if len(rel) == 0 {
+				return nil
+			}
+
+			if r.ignores.match(rel) || goIgnored(info.Name()) || (info.Name() == "vendor" && !r.opts.IncludeVendor) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		})
+	}
+
+	return files
+}
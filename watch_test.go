@@ -0,0 +1,70 @@
+package overalls
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/go-playground/assert.v1"
+)
+
+func TestWatch(t *testing.T) {
+	dir, undo := changedRepo(t)
+	defer undo()
+
+	oldInterval := watchInterval
+	watchInterval = 50 * time.Millisecond
+	defer func() { watchInterval = oldInterval }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := &bytes.Buffer{}
+	var coverage []float64
+	var tested [][]string
+
+	write := func(name, content string) {
+		Equal(t, ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644), nil)
+	}
+
+	err := Watch(ctx, Options{Project: "example.com/changed", Logger: log.New(out, "", 0)}, func(res Result, err error) {
+		Equal(t, err, nil)
+		coverage = append(coverage, res.Coverage)
+
+		var packages []string
+		for _, p := range res.Packages {
+			packages = append(packages, p.ImportPath)
+		}
+		tested = append(tested, packages)
+
+		switch len(coverage) {
+		case 1:
+			// half of C is no longer tested
+			write("c/c.go", "package c\n\nfunc C() int { return 3 }\n\nfunc D() int { return 4 }\n")
+		case 2:
+			// nor half of A, which B imports
+			write("a/a.go", "package a\n\nfunc A() int { return 1 }\n\nfunc A2() int { return 2 }\n")
+		default:
+			cancel()
+		}
+	})
+	Equal(t, err, context.Canceled)
+	Equal(t, tested, [][]string{
+		{"example.com/changed/a", "example.com/changed/b", "example.com/changed/c", "example.com/changed/d"},
+		{"example.com/changed/c"},
+		{"example.com/changed/a", "example.com/changed/b"},
+	})
+
+	// the packages not tested again keep their coverage
+	Equal(t, coverage, []float64{100, 75, 60})
+	MatchRegex(t, out.String(), "Watching for changes to .go files\nFiles changed, testing again\n")
+
+	err = Watch(context.Background(), Options{Project: "example.com/changed", Concurrency: -1}, func(Result, error) {
+		t.Fatal("run with invalid options")
+	})
+	Equal(t, err.Error(), "invalid concurrency '-1', must be at least 1")
+}